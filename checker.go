@@ -0,0 +1,477 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type verdict int
+
+const (
+	unknownVerdict verdict = iota
+	trueVerdict
+	falseVerdict
+	boundVerdict // the formula is a place-bound and its exact value is known
+)
+
+func (v verdict) String() string {
+	switch v {
+	case trueVerdict:
+		return "TRUE"
+	case falseVerdict:
+		return "FALSE"
+	case boundVerdict:
+		return "BOUND"
+	}
+	return "UNKNOWN"
+}
+
+// number of states explored first when checking formulas
+const firstStateBudget int = 64
+
+// result of the model checking of one formula
+type checkResult struct {
+	verdict verdict
+	bound   int   // for place-bound formulas, the largest value found
+	states  int   // number of states explored
+	err     error // why the formula cannot be checked, nil if it can
+}
+
+// part of the state space of a net, explored from its initial marking
+// states that are not expanded may have successors that were not explored
+type stateSpace struct {
+	net          *petriNet
+	markings     []marking
+	successors   [][]int
+	predecessors [][]int
+	expanded     []bool
+}
+
+// check CTL and place-bound formulas on a PT model, exploring at most
+// maxStates states, formulas that cannot be decided within this budget
+// get unknownVerdict, formulas that cannot be checked at all (LTL formulas
+// with nested temporal operators) get an error
+//
+// The state space is explored with budgets doubling from firstStateBudget,
+// so that the number of states given for a decided formula is about the
+// number of states needed for deciding it (the whole budget for undecided
+// formulas), this at most doubles the exploration time.
+func (net *petriNet) check(formulas []formula, maxStates int) []checkResult {
+	results := make([]checkResult, len(formulas))
+	done := make([]bool, len(formulas))
+	budget := firstStateBudget
+	for {
+		if budget > maxStates {
+			budget = maxStates
+		}
+		s := net.explore(budget)
+		complete := budget >= maxStates || s.isComplete()
+		for i, f := range formulas {
+			if done[i] {
+				continue
+			}
+			results[i] = s.checkFormula(f)
+			results[i].states = len(s.markings)
+			done[i] = results[i].verdict != unknownVerdict || results[i].err != nil
+		}
+		if complete {
+			return results
+		}
+		budget *= 2
+	}
+}
+
+// check a formula on an explored part of the state space
+func (s *stateSpace) checkFormula(f formula) (res checkResult) {
+	if f.operator.name == "place-bound" {
+		return s.checkBound(f)
+	}
+	t, ff, err := s.eval(f)
+	if err != nil {
+		res.err = err
+		return res
+	}
+	switch {
+	case t[0]:
+		res.verdict = trueVerdict
+	case ff[0]:
+		res.verdict = falseVerdict
+	}
+	return res
+}
+
+// maximal number of tokens in a set of places, the bound is exact if the
+// whole state space was explored or if no transition can increase the
+// number of tokens in the set (the bound is then given by the initial marking)
+func (s *stateSpace) checkBound(f formula) (res checkResult) {
+	inSet := make(map[int]bool)
+	for _, p := range f.operand {
+		num, exists := s.net.placeIndex[p.operator.name]
+		if !exists {
+			return res
+		}
+		inSet[num] = true
+	}
+
+	for _, m := range s.markings {
+		tokens := 0
+		for p := range inSet {
+			tokens += m[p]
+		}
+		if tokens > res.bound {
+			res.bound = tokens
+		}
+	}
+
+	if s.isComplete() {
+		res.verdict = boundVerdict
+		return res
+	}
+	if bound, known := s.net.initialBound(f); known {
+		res.verdict = boundVerdict
+		res.bound = bound
+	}
+	return res
+}
+
+// breadth first exploration of the state space, state 0 is the initial marking
+func (net *petriNet) explore(maxStates int) *stateSpace {
+	s := stateSpace{net: net}
+	index := make(map[string]int)
+	s.addState(net.initialMarking, index)
+	for current := 0; current < len(s.markings); current++ {
+		expanded := true
+		for t := range net.transitions {
+			if !net.isEnabled(s.markings[current], t) {
+				continue
+			}
+			next := net.fire(s.markings[current], t)
+			nextNum, known := index[next.key()]
+			if !known {
+				if len(s.markings) >= maxStates {
+					expanded = false
+					continue
+				}
+				nextNum = s.addState(next, index)
+			}
+			s.successors[current] = append(s.successors[current], nextNum)
+			s.predecessors[nextNum] = append(s.predecessors[nextNum], current)
+		}
+		s.expanded[current] = expanded
+	}
+	return &s
+}
+
+func (s *stateSpace) addState(m marking, index map[string]int) int {
+	num := len(s.markings)
+	index[m.key()] = num
+	s.markings = append(s.markings, m)
+	s.successors = append(s.successors, nil)
+	s.predecessors = append(s.predecessors, nil)
+	s.expanded = append(s.expanded, false)
+	return num
+}
+
+// checks if the whole state space was explored
+func (s *stateSpace) isComplete() bool {
+	for _, e := range s.expanded {
+		if !e {
+			return false
+		}
+	}
+	return true
+}
+
+// three-valued evaluation of a state formula: for each state, t tells if the
+// formula is known to hold and f tells if it is known not to hold
+func (s *stateSpace) eval(phi formula) (t, f []bool, err error) {
+	n := len(s.markings)
+	switch phi.operator.name {
+	case "not":
+		t, f, err = s.eval(phi.operand[0])
+		return f, t, err
+	case "and", "or":
+		isAnd := phi.operator.name == "and"
+		t, f = constant(n, isAnd), constant(n, !isAnd)
+		for _, operand := range phi.operand {
+			ot, of, err := s.eval(operand)
+			if err != nil {
+				return nil, nil, err
+			}
+			for i := 0; i < n; i++ {
+				if isAnd {
+					t[i] = t[i] && ot[i]
+					f[i] = f[i] || of[i]
+				} else {
+					t[i] = t[i] || ot[i]
+					f[i] = f[i] && of[i]
+				}
+			}
+		}
+		return t, f, nil
+	case "A", "E":
+		return s.evalPath(phi.operand[0], phi.operator.name == "A")
+	case "is-fireable":
+		transitions := make([]int, len(phi.operand))
+		for i, tr := range phi.operand {
+			num, exists := s.net.transitionIndex[tr.operator.name]
+			if !exists {
+				return nil, nil, fmt.Errorf("unknown transition %s", tr.operator.name)
+			}
+			transitions[i] = num
+		}
+		t, f = make([]bool, n), make([]bool, n)
+		for i, m := range s.markings {
+			for _, tr := range transitions {
+				if s.net.isEnabled(m, tr) {
+					t[i] = true
+					break
+				}
+			}
+			f[i] = !t[i]
+		}
+		return t, f, nil
+	case "leq":
+		left, err := s.evalInteger(phi.operand[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		right, err := s.evalInteger(phi.operand[1])
+		if err != nil {
+			return nil, nil, err
+		}
+		t, f = make([]bool, n), make([]bool, n)
+		for i := 0; i < n; i++ {
+			t[i] = left[i] <= right[i]
+			f[i] = !t[i]
+		}
+		return t, f, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported operator %s in state formula", phi.operator.name)
+}
+
+// evaluation of an integer expression in each state
+func (s *stateSpace) evalInteger(phi formula) ([]int, error) {
+	values := make([]int, len(s.markings))
+	switch phi.operator.name {
+	case "integer-constant":
+		c, err := strconv.Atoi(phi.operand[0].operator.name)
+		if err != nil {
+			return nil, err
+		}
+		for i := range values {
+			values[i] = c
+		}
+		return values, nil
+	case "tokens-count":
+		places := make([]int, len(phi.operand))
+		for i, p := range phi.operand {
+			num, exists := s.net.placeIndex[p.operator.name]
+			if !exists {
+				return nil, fmt.Errorf("unknown place %s", p.operator.name)
+			}
+			places[i] = num
+		}
+		for i, m := range s.markings {
+			for _, p := range places {
+				values[i] += m[p]
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unsupported operator %s in integer expression", phi.operator.name)
+}
+
+// evaluation of a path formula under a path quantifier (A if universal, E otherwise)
+func (s *stateSpace) evalPath(phi formula, universal bool) (t, f []bool, err error) {
+	n := len(s.markings)
+	operands := make([][2][]bool, len(phi.operand))
+	for i, operand := range phi.operand {
+		if containsPathFormula(operand) {
+			return nil, nil, fmt.Errorf("temporal operator under %s, only CTL formulas and LTL formulas with one temporal operator can be checked", phi.operator.name)
+		}
+		operands[i][0], operands[i][1], err = s.eval(operand)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	switch phi.operator.name {
+	case "X":
+		return s.next(operands[0][0], operands[0][1], universal)
+	case "U":
+		return s.until(operands[0][0], operands[0][1], operands[1][0], operands[1][1], universal)
+	case "F":
+		return s.until(constant(n, true), constant(n, false), operands[0][0], operands[0][1], universal)
+	case "G":
+		// A G phi = not E (true U not phi), E G phi = not A (true U not phi)
+		t, f, err = s.until(constant(n, true), constant(n, false), operands[0][1], operands[0][0], !universal)
+		return f, t, err
+	}
+	return nil, nil, errors.New("not a CTL formula")
+}
+
+// checks if a formula contains a temporal operator which is not under a path
+// quantifier, nested CTL formulas such as A G E F phi are state formulas
+func containsPathFormula(f formula) bool {
+	if f.operator == allPathsOperator || f.operator == existsPathOperator {
+		return false
+	}
+	for _, op := range pathOperators {
+		if f.operator == op {
+			return true
+		}
+	}
+	for _, operand := range f.operand {
+		if containsPathFormula(operand) {
+			return true
+		}
+	}
+	return false
+}
+
+// A X phi and E X phi, on maximal paths (no next state after a deadlock)
+func (s *stateSpace) next(pt, pf []bool, universal bool) (t, f []bool, err error) {
+	n := len(s.markings)
+	t, f = make([]bool, n), make([]bool, n)
+	for i := 0; i < n; i++ {
+		deadlock := s.expanded[i] && len(s.successors[i]) == 0
+		if universal {
+			t[i] = s.expanded[i] && !deadlock && s.allSuccessors(i, pt)
+			f[i] = deadlock || s.someSuccessor(i, pf)
+		} else {
+			t[i] = s.someSuccessor(i, pt)
+			f[i] = s.expanded[i] && s.allSuccessors(i, pf)
+		}
+	}
+	return t, f, nil
+}
+
+// A (phi U psi) and E (phi U psi), on maximal paths
+func (s *stateSpace) until(phiT, phiF, psiT, psiF []bool, universal bool) (t, f []bool, err error) {
+	n := len(s.markings)
+	if universal {
+		cond := make([]bool, n)
+		notF := make([]bool, n)
+		notFCond := make([]bool, n)
+		for i := 0; i < n; i++ {
+			deadlock := s.expanded[i] && len(s.successors[i]) == 0
+			cond[i] = phiT[i] && s.expanded[i] && !deadlock
+			notF[i] = !psiF[i]
+			notFCond[i] = !phiF[i] && !deadlock
+		}
+		t = s.leastAll(psiT, cond)
+		f = negate(s.leastAll(notF, notFCond))
+		return t, f, nil
+	}
+	base := make([]bool, n)
+	cond := make([]bool, n)
+	for i := 0; i < n; i++ {
+		base[i] = !psiF[i] || (!phiF[i] && !s.expanded[i])
+		cond[i] = !phiF[i]
+	}
+	t = s.leastExists(psiT, phiT)
+	f = negate(s.leastExists(base, cond))
+	return t, f, nil
+}
+
+// least set Z such that Z = base or (cond and some successor in Z)
+func (s *stateSpace) leastExists(base, cond []bool) []bool {
+	z := make([]bool, len(base))
+	queue := make([]int, 0)
+	for i, b := range base {
+		if b {
+			z[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, p := range s.predecessors[current] {
+			if !z[p] && cond[p] {
+				z[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return z
+}
+
+// least set Z such that Z = base or (cond and all known successors in Z)
+func (s *stateSpace) leastAll(base, cond []bool) []bool {
+	z := make([]bool, len(base))
+	missing := make([]int, len(base))
+	queue := make([]int, 0)
+	for i := range base {
+		missing[i] = len(s.successors[i])
+		if base[i] || (cond[i] && missing[i] == 0) {
+			z[i] = true
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, p := range s.predecessors[current] {
+			missing[p]--
+			if !z[p] && cond[p] && missing[p] == 0 {
+				z[p] = true
+				queue = append(queue, p)
+			}
+		}
+	}
+	return z
+}
+
+func (s *stateSpace) someSuccessor(state int, set []bool) bool {
+	for _, succ := range s.successors[state] {
+		if set[succ] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *stateSpace) allSuccessors(state int, set []bool) bool {
+	for _, succ := range s.successors[state] {
+		if !set[succ] {
+			return false
+		}
+	}
+	return true
+}
+
+func constant(n int, value bool) []bool {
+	c := make([]bool, n)
+	for i := range c {
+		c[i] = value
+	}
+	return c
+}
+
+func negate(set []bool) []bool {
+	neg := make([]bool, len(set))
+	for i, v := range set {
+		neg[i] = !v
+	}
+	return neg
+}
@@ -0,0 +1,187 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+// a transition of a test net, with the weights of its input and output places
+type testTransition struct {
+	name      string
+	pre, post map[string]int
+}
+
+// build a PT net by hand, places are given with their initial marking
+func newTestNet(places []string, initialMarking []int, transitions ...testTransition) *petriNet {
+	net := &petriNet{
+		places:          places,
+		placeIndex:      make(map[string]int),
+		transitionIndex: make(map[string]int),
+		initialMarking:  initialMarking,
+	}
+	for i, p := range places {
+		net.placeIndex[p] = i
+	}
+	for i, t := range transitions {
+		net.transitions = append(net.transitions, t.name)
+		net.transitionIndex[t.name] = i
+		var pre, post []arcWeight
+		for _, p := range places {
+			if w, ok := t.pre[p]; ok {
+				pre = addArc(pre, net.placeIndex[p], w)
+			}
+			if w, ok := t.post[p]; ok {
+				post = addArc(post, net.placeIndex[p], w)
+			}
+		}
+		net.pre = append(net.pre, pre)
+		net.post = append(net.post, post)
+	}
+	return net
+}
+
+// p0 -> t0 -> p1 -> t1 -> p0, one token in p0
+func cycleNet() *petriNet {
+	return newTestNet(
+		[]string{"p0", "p1"}, []int{1, 0},
+		testTransition{"t0", map[string]int{"p0": 1}, map[string]int{"p1": 1}},
+		testTransition{"t1", map[string]int{"p1": 1}, map[string]int{"p0": 1}},
+	)
+}
+
+// t0 consumes the only token of p0, then the net is dead
+func deadlockNet() *petriNet {
+	return newTestNet(
+		[]string{"p0"}, []int{1},
+		testTransition{"t0", map[string]int{"p0": 1}, nil},
+	)
+}
+
+// t0 adds a token to p0 forever
+func unboundedNet() *petriNet {
+	return newTestNet(
+		[]string{"p0"}, []int{0},
+		testTransition{"t0", nil, map[string]int{"p0": 1}},
+	)
+}
+
+// formulas of the tests, built by hand
+
+func nodes(names ...string) []formula {
+	f := make([]formula, len(names))
+	for i, name := range names {
+		f[i] = formula{operator: operator{name: name}}
+	}
+	return f
+}
+
+func fireable(transitions ...string) formula {
+	return formula{operator: isfireable, operand: nodes(transitions...)}
+}
+
+func tokens(places ...string) formula {
+	return formula{operator: tokencount, operand: nodes(places...)}
+}
+
+func integer(c int) formula {
+	return formula{operator: integerconstant, operand: nodes(strconv.Itoa(c))}
+}
+
+func leq(left, right formula) formula {
+	return formula{operator: leqOperator, operand: []formula{left, right}}
+}
+
+// a path quantifier applied to a temporal operator
+func modal(quantifier, temporal operator, operands ...formula) formula {
+	return formula{operator: quantifier, operand: []formula{{operator: temporal, operand: operands}}}
+}
+
+func TestCheck(t *testing.T) {
+	A, E := allPathsOperator, existsPathOperator
+	G, F, X, U := globallyOperator, finallyOperator, nextOperator, untilOperator
+	tests := []struct {
+		name      string
+		net       *petriNet
+		formula   formula
+		maxStates int
+		verdict   verdict
+		bound     int
+	}{
+		{"invariant", cycleNet(), modal(A, G, leq(tokens("p0", "p1"), integer(1))), 100, trueVerdict, 0},
+		{"reachable", cycleNet(), modal(E, F, fireable("t1")), 100, trueVerdict, 0},
+		{"not always", cycleNet(), modal(A, G, fireable("t0")), 100, falseVerdict, 0},
+		{"inevitable", cycleNet(), modal(A, F, fireable("t1")), 100, trueVerdict, 0},
+		{"next", cycleNet(), modal(E, X, fireable("t1")), 100, trueVerdict, 0},
+		{"all next", cycleNet(), modal(A, X, fireable("t0")), 100, falseVerdict, 0},
+		{"until", cycleNet(), modal(A, U, fireable("t0"), fireable("t1")), 100, trueVerdict, 0},
+		{"nested CTL", cycleNet(), modal(A, G, modal(E, F, fireable("t0"))), 100, trueVerdict, 0},
+		{"bound", cycleNet(), formula{operator: placebound, operand: nodes("p1")}, 100, boundVerdict, 1},
+		{"deadlock", deadlockNet(), modal(A, G, fireable("t0")), 100, falseVerdict, 0},
+		{"no next after deadlock", deadlockNet(), modal(A, X, modal(A, X, fireable("t0"))), 100, falseVerdict, 0},
+		{"found within budget", unboundedNet(), modal(E, F, leq(integer(5), tokens("p0"))), 10, trueVerdict, 0},
+		{"beyond budget", unboundedNet(), modal(E, F, leq(integer(50), tokens("p0"))), 10, unknownVerdict, 0},
+		{"unbounded", unboundedNet(), formula{operator: placebound, operand: nodes("p0")}, 10, unknownVerdict, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := test.net.check([]formula{test.formula}, test.maxStates)[0]
+			if r.err != nil {
+				t.Fatalf("unexpected error: %v", r.err)
+			}
+			if r.verdict != test.verdict {
+				t.Errorf("verdict %v, expected %v", r.verdict, test.verdict)
+			}
+			if test.verdict == boundVerdict && r.bound != test.bound {
+				t.Errorf("bound %d, expected %d", r.bound, test.bound)
+			}
+			if r.states < 1 || r.states > test.maxStates {
+				t.Errorf("%d states explored with a budget of %d", r.states, test.maxStates)
+			}
+		})
+	}
+}
+
+// the state budget doubles until formulas are decided, so easy formulas are
+// decided after exploring fewer states than the budget
+func TestCheckStates(t *testing.T) {
+	results := unboundedNet().check([]formula{
+		modal(existsPathOperator, finallyOperator, leq(integer(5), tokens("p0"))),
+		modal(existsPathOperator, finallyOperator, leq(integer(1000), tokens("p0"))),
+	}, 4*firstStateBudget)
+	if results[0].states != firstStateBudget {
+		t.Errorf("easy formula decided after %d states, expected %d", results[0].states, firstStateBudget)
+	}
+	if results[1].verdict != unknownVerdict || results[1].states != 4*firstStateBudget {
+		t.Errorf("hard formula %v after %d states, expected UNKNOWN after %d", results[1].verdict, results[1].states, 4*firstStateBudget)
+	}
+}
+
+func TestCheckUnsupportedLTL(t *testing.T) {
+	for name, f := range map[string]formula{
+		"A G F": modal(allPathsOperator, globallyOperator, formula{operator: finallyOperator, operand: []formula{fireable("t0")}}),
+		"A U G": modal(allPathsOperator, untilOperator, fireable("t0"), formula{operator: globallyOperator, operand: []formula{fireable("t1")}}),
+	} {
+		r := cycleNet().check([]formula{f}, 100)[0]
+		if r.err == nil {
+			t.Errorf("%s: checked (%v), expected an error", name, r.verdict)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Checker is a model checker used for filtering formulas. It gives the
+// verdicts it could obtain for a set of formulas on a PT model, formulas
+// without result are skipped (neither hard nor decided). An error is returned
+// if the model checker could not be run or crashed, with the results already
+// obtained.
+type Checker interface {
+	name() string
+	check(r checkRequest, logger *log.Logger) ([]checkerResult, error)
+}
+
+// formulas to check on a PT model
+type checkRequest struct {
+	model     *modelInfo // model the formulas were generated for
+	modelPath string     // pnml file of the PT model (the twin of COL models)
+	net       *petriNet  // PT model, parsed (nil if it could not be)
+	formulas  []formula  // formulas on the nodes of the PT model
+	numToFind int        // number of undecided formulas after which the checker may stop
+	job       string     // name of the filtering job, for naming its files
+}
+
+// result given by a model checker for one formula
+type checkerResult struct {
+	index     int // index of the formula in the checked set
+	verdict   verdict
+	bound     int    // for place-bound formulas with boundVerdict
+	states    int    // number of states explored, -1 if not given
+	technique string // techniques used by the checker, as in the MCC outputs
+	timedOut  bool   // no verdict as the checker was stopped by the timeout
+	err       error  // the checker cannot check the formula
+}
+
+// the model checker chosen in the configuration, exploring at most maxStates
+// states when it is state-bounded
+func newChecker(maxStates int) (Checker, error) {
+	if globalConfiguration.TimeoutPolicy != "hard" && globalConfiguration.TimeoutPolicy != "unknown" {
+		return nil, fmt.Errorf("unknown timeout policy %s (available policies are hard and unknown)", globalConfiguration.TimeoutPolicy)
+	}
+	switch globalConfiguration.Checker {
+	case "native":
+		return nativeChecker{maxStates: maxStates}, nil
+	case "smc":
+		return smcChecker{path: globalConfiguration.SMCPath, maxStates: maxStates}, nil
+	case "benchkit":
+		if globalConfiguration.CheckerCommand == "" {
+			return nil, errors.New("benchkit checker: no CheckerCommand")
+		}
+		return benchKitChecker{command: strings.Fields(globalConfiguration.CheckerCommand)}, nil
+	}
+	return nil, fmt.Errorf("unknown checker %s (available checkers are native, smc and benchkit)", globalConfiguration.Checker)
+}
+
+// the built-in explicit-state model checker
+type nativeChecker struct {
+	maxStates int
+}
+
+func (c nativeChecker) name() string {
+	return "native"
+}
+
+func (c nativeChecker) check(r checkRequest, logger *log.Logger) ([]checkerResult, error) {
+	if r.net == nil {
+		return nil, errors.New("native checker: no PT net")
+	}
+	results := make([]checkerResult, len(r.formulas))
+	for i, res := range r.net.check(r.formulas, c.maxStates) {
+		results[i] = checkerResult{index: i, verdict: res.verdict, bound: res.bound, states: res.states, technique: "EXPLICIT", err: res.err}
+	}
+	return results, nil
+}
+
+// external model checkers read the formulas in the MCC xml format, with ids
+// giving their index in the checked set
+func (r checkRequest) writeFormulas(logger *log.Logger) (fileName string) {
+	fileName = fmt.Sprint(globalConfiguration.SMCTmpFileName, "-", r.job, ".xml")
+	r.model.writexmlFormulas(r.formulas, fileName, "ForFiltering", false, logger)
+	return fileName
+}
+
+// Run an external model checker, within the configured time and memory
+// limits. Its output is appended to the log file of the job and parsed
+// line by line, the lines of its error output are logged. If it is stopped
+// by the timeout before closing its output, the formulas it gave no result
+// for are timed out.
+func runChecker(args, env []string, numFormulas int, job string, logger *log.Logger, parse func(io.Reader) ([]checkerResult, error)) ([]checkerResult, error) {
+	name := args[0]
+	if globalConfiguration.CheckerMemory > 0 {
+		args = limitMemory(args, globalConfiguration.CheckerMemory)
+	}
+	command := exec.Command(args[0], args[1:]...)
+	command.Env = append(os.Environ(), env...)
+	setProcessGroup(command)
+	var stderr bytes.Buffer
+	command.Stderr = &stderr
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("%s output: %w", name, err)
+	}
+
+	logFile, err := os.OpenFile(fmt.Sprint(globalConfiguration.SMClogfile, "-", job), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("checker log file: %w", err)
+	}
+	defer logFile.Close()
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if globalConfiguration.CheckerTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), time.Duration(globalConfiguration.CheckerTimeout)*time.Second)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	defer cancel()
+
+	if err := command.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", name, err)
+	}
+	// kill the checker and all the processes it started on timeout, so
+	// that its output is closed
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	killed := false
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			killed = true
+			if err := killProcessGroup(command); err != nil {
+				logger.Print("ERROR: cannot kill ", name, ": ", err)
+			}
+		case <-done:
+		}
+	}()
+	results, readErr := parse(io.TeeReader(stdout, logFile))
+	// the output is closed, stop watching the timeout before waiting for the
+	// checker, as its process group may be reused once it is waited for
+	close(done)
+	<-stopped
+	err = command.Wait()
+	for _, line := range strings.Split(stderr.String(), "\n") {
+		if line != "" {
+			logger.Print("CHECKER ERROR: ", line)
+		}
+	}
+
+	if killed {
+		logger.Print("Warning: ", name, " stopped after ", globalConfiguration.CheckerTimeout, " s")
+		answered := make([]bool, numFormulas)
+		for _, r := range results {
+			if r.index < numFormulas {
+				answered[r.index] = true
+			}
+		}
+		for i := range answered {
+			if !answered[i] {
+				results = append(results, checkerResult{index: i, verdict: unknownVerdict, states: -1, timedOut: true})
+			}
+		}
+		return results, nil
+	}
+	if err != nil {
+		return results, fmt.Errorf("%s: %w", name, err)
+	}
+	if readErr != nil {
+		return results, fmt.Errorf("%s output: %w", name, readErr)
+	}
+	return results, nil
+}
+
+// the simple model checker of earlier generators
+type smcChecker struct {
+	path      string
+	maxStates int
+}
+
+var (
+	smcFormulaIndex = regexp.MustCompile(`ForFiltering-\d+-(\d+)`)
+	smcStates       = regexp.MustCompile(`(\d+) states`)
+)
+
+func (c smcChecker) name() string {
+	return "SMC"
+}
+
+func (c smcChecker) check(r checkRequest, logger *log.Logger) ([]checkerResult, error) {
+	formulas := r.writeFormulas(logger)
+	smcMaxStates := fmt.Sprint("--max-states=", c.maxStates)
+	smcStopAfter := fmt.Sprint("--mcc15-stop-after=", r.numToFind)
+	args := []string{"python", c.path, "--use10", smcMaxStates, smcStopAfter, r.modelPath, formulas}
+	return runChecker(args, nil, len(r.formulas), r.job, logger, func(out io.Reader) ([]checkerResult, error) {
+		return parseSMCOutput(out, logger)
+	})
+}
+
+// parse the output of SMC: messages (starting with smc:) are logged, result
+// lines give the id of a formula (ending with ForFiltering-<year>-<index>)
+// and ? when the formula could not be decided
+func parseSMCOutput(r io.Reader, logger *log.Logger) ([]checkerResult, error) {
+	results := make([]checkerResult, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "smc:") {
+			logger.Print(line)
+			continue
+		}
+		match := smcFormulaIndex.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		index, err := strconv.Atoi(line[match[2]:match[3]])
+		if err != nil {
+			logger.Print("ERROR: SMC output, formula index: ", err)
+			continue
+		}
+		res := checkerResult{index: index, verdict: unknownVerdict, states: -1, technique: "SMC"}
+		for _, field := range strings.Fields(line[match[1]:]) {
+			switch field {
+			case "TRUE":
+				res.verdict = trueVerdict
+			case "FALSE":
+				res.verdict = falseVerdict
+			}
+		}
+		if !strings.Contains(line[match[1]:], "?") && res.verdict == unknownVerdict {
+			// decided, but the verdict is not given in a known way
+			continue
+		}
+		if states := smcStates.FindStringSubmatch(line); states != nil {
+			res.states, _ = strconv.Atoi(states[1])
+		}
+		results = append(results, res)
+	}
+	return results, scanner.Err()
+}
+
+// Any tool following the output convention of the MCC BenchKit
+// (FORMULA <id> TRUE/FALSE/<bound> TECHNIQUES ...), run with a command
+// template whose fields may contain:
+//   - {model}: the pnml file of the PT model
+//   - {directory}: the directory of this pnml file
+//   - {formulas}: the xml file of the formulas to check
+//   - {examination}: the examination of the formulas
+//   - {timeout} and {memory}: the configured limits (seconds and MB)
+//
+// The examination and limits are also given in the BK_EXAMINATION,
+// BK_TIME_CONFINEMENT and BK_MEMORY_CONFINEMENT environment variables.
+// Formulas the tool gives no verdict for are undecided.
+type benchKitChecker struct {
+	command []string
+}
+
+var benchKitResult = regexp.MustCompile(`^FORMULA\s+(\S+)\s+(\S+)\s+TECHNIQUES\b(.*)$`)
+
+func (c benchKitChecker) name() string {
+	return "BenchKit"
+}
+
+func (c benchKitChecker) check(r checkRequest, logger *log.Logger) ([]checkerResult, error) {
+	formulas := r.writeFormulas(logger)
+	examination := examinationOf(r.formulas)
+	replacer := strings.NewReplacer(
+		"{model}", r.modelPath,
+		"{directory}", filepath.Dir(r.modelPath),
+		"{formulas}", formulas,
+		"{examination}", examination,
+		"{timeout}", strconv.Itoa(globalConfiguration.CheckerTimeout),
+		"{memory}", strconv.Itoa(globalConfiguration.CheckerMemory),
+	)
+	args := make([]string, len(c.command))
+	for i, field := range c.command {
+		args[i] = replacer.Replace(field)
+	}
+
+	env := []string{
+		"BK_EXAMINATION=" + examination,
+		fmt.Sprint("BK_TIME_CONFINEMENT=", globalConfiguration.CheckerTimeout),
+		fmt.Sprint("BK_MEMORY_CONFINEMENT=", globalConfiguration.CheckerMemory),
+	}
+
+	// the ids of the formulas, as written in the formulas file
+	indices := make(map[string]int)
+	for i, p := range r.model.asProperties(r.formulas, "ForFiltering") {
+		indices[p.id] = i
+	}
+
+	results, err := runChecker(args, env, len(r.formulas), r.job, logger, func(out io.Reader) ([]checkerResult, error) {
+		return parseBenchKitOutput(out, indices)
+	})
+
+	// formulas the tool gives no verdict for are undecided
+	answered := make([]bool, len(r.formulas))
+	for _, res := range results {
+		answered[res.index] = true
+	}
+	for i := range answered {
+		if !answered[i] {
+			results = append(results, checkerResult{index: i, verdict: unknownVerdict, states: -1})
+		}
+	}
+	return results, err
+}
+
+// parse the output of a BenchKit tool, keeping the formulas with a verdict
+func parseBenchKitOutput(r io.Reader, indices map[string]int) ([]checkerResult, error) {
+	results := make([]checkerResult, 0)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		match := benchKitResult.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+		index, known := indices[match[1]]
+		if !known {
+			continue
+		}
+		res := checkerResult{index: index, states: -1, technique: strings.Join(strings.Fields(match[3]), " ")}
+		switch value := match[2]; value {
+		case "TRUE":
+			res.verdict = trueVerdict
+		case "FALSE":
+			res.verdict = falseVerdict
+		default:
+			bound, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			res.verdict = boundVerdict
+			res.bound = bound
+		}
+		results = append(results, res)
+	}
+	return results, scanner.Err()
+}
+
+// the examination a set of formulas (of the same kind) belongs to, the most
+// specific one when several are possible
+func examinationOf(formulas []formula) string {
+	atoms, bounds, reachability, ltl := "Cardinality", true, true, true
+	for _, f := range formulas {
+		if containsOperator(f, "is-fireable") {
+			atoms = "Fireability"
+		}
+		bounds = bounds && f.operator.name == "place-bound"
+		reachability = reachability && isReachabilityFormula(f)
+		ltl = ltl && isLTLFormula(f)
+	}
+	switch {
+	case bounds:
+		return "UpperBounds"
+	case reachability:
+		return "Reachability" + atoms
+	case ltl:
+		return "LTL" + atoms
+	}
+	return "CTL" + atoms
+}
+
+func containsOperator(f formula, name string) bool {
+	if f.operator.name == name {
+		return true
+	}
+	for _, operand := range f.operand {
+		if containsOperator(operand, name) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseSMCOutput(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected []checkerResult
+		logged   string
+	}{
+		{
+			"empty output", "", []checkerResult{}, "",
+		},
+		{
+			"messages only",
+			"smc: loading model INPUTS/Toy-PT-001/model.pnml\nsmc: exploring state space\n",
+			[]checkerResult{},
+			"smc: loading model INPUTS/Toy-PT-001/model.pnml\nsmc: exploring state space\n",
+		},
+		{
+			"verdicts",
+			"smc: loading model INPUTS/Toy-PT-001/model.pnml\n" +
+				"FORMULA Toy-PT-001-ForFiltering-2024-00 TRUE TECHNIQUES EXPLICIT 12 states\n" +
+				"FORMULA Toy-PT-001-ForFiltering-2024-01 FALSE TECHNIQUES EXPLICIT\n" +
+				"FORMULA Toy-PT-001-ForFiltering-2024-02 ? TECHNIQUES EXPLICIT 50 states\n",
+			[]checkerResult{
+				{index: 0, verdict: trueVerdict, states: 12, technique: "SMC"},
+				{index: 1, verdict: falseVerdict, states: -1, technique: "SMC"},
+				{index: 2, verdict: unknownVerdict, states: 50, technique: "SMC"},
+			},
+			"smc: loading model INPUTS/Toy-PT-001/model.pnml\n",
+		},
+		{
+			// the number of dashes in the instance does not matter
+			"instance with dashes",
+			"Philosophers-PT-000005-b-1-ForFiltering-2024-13 ?\n",
+			[]checkerResult{{index: 13, verdict: unknownVerdict, states: -1, technique: "SMC"}},
+			"",
+		},
+		{
+			"unknown verdict",
+			"FORMULA Toy-PT-001-ForFiltering-2024-04 MAYBE TECHNIQUES EXPLICIT\n" +
+				"FORMULA Toy-PT-001-ForFiltering-2024-05 TRUE TECHNIQUES EXPLICIT\n",
+			[]checkerResult{{index: 5, verdict: trueVerdict, states: -1, technique: "SMC"}},
+			"",
+		},
+		{
+			"other lines",
+			"Traceback (most recent call last):\nFORMULA Toy-PT-001-ForFiltering TRUE\n",
+			[]checkerResult{},
+			"",
+		},
+		{
+			"output cut by a crash",
+			"FORMULA Toy-PT-001-ForFiltering-2024-00 TRUE TECHNIQUES EXPLICIT\nFORMULA Toy-PT-001-ForFil",
+			[]checkerResult{{index: 0, verdict: trueVerdict, states: -1, technique: "SMC"}},
+			"",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var logged bytes.Buffer
+			results, err := parseSMCOutput(strings.NewReader(test.output), log.New(&logged, "", 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(results, test.expected) {
+				t.Errorf("results %+v, expected %+v", results, test.expected)
+			}
+			if logged.String() != test.logged {
+				t.Errorf("logged %q, expected %q", logged.String(), test.logged)
+			}
+		})
+	}
+}
+
+// a checker that crashes gives an error, with the results it gave before
+func TestRunCheckerCrash(t *testing.T) {
+	setTestConfig(t, func(c *config) { c.SMClogfile = filepath.Join(t.TempDir(), "smclog") })
+	var logged bytes.Buffer
+	logger := log.New(&logged, "", 0)
+	for _, test := range []struct {
+		name    string
+		script  string
+		results int
+	}{
+		{"empty output", "exit 1", 0},
+		{"some results", "echo 'FORMULA Toy-PT-001-ForFiltering-2024-01 FALSE TECHNIQUES EXPLICIT'; echo Traceback >&2; exit 1", 1},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := runChecker([]string{"sh", "-c", test.script}, nil, 2, "job", logger, func(out io.Reader) ([]checkerResult, error) {
+				return parseSMCOutput(out, logger)
+			})
+			if err == nil {
+				t.Error("no error")
+			}
+			if len(results) != test.results {
+				t.Errorf("%d results, expected %d", len(results), test.results)
+			}
+			for _, r := range results {
+				if r.index != 1 || r.verdict != falseVerdict || r.timedOut {
+					t.Errorf("result %+v", r)
+				}
+			}
+		})
+	}
+	if !strings.Contains(logged.String(), "CHECKER ERROR: Traceback") {
+		t.Errorf("error output not logged:\n%s", logged.String())
+	}
+}
+
+func TestExaminationOf(t *testing.T) {
+	A, E := allPathsOperator, existsPathOperator
+	G, F, X, U := globallyOperator, finallyOperator, nextOperator, untilOperator
+	cardinality := leq(tokens("p0"), integer(1))
+	// sets mixing several kinds of formulas can only be CTL ones
+	tests := []struct {
+		name        string
+		formulas    []formula
+		examination string
+	}{
+		{"bounds", []formula{placeBound("p0"), placeBound("p0", "p1")}, "UpperBounds"},
+		{"reachability", []formula{modal(A, G, cardinality), modal(E, F, cardinality)}, "ReachabilityCardinality"},
+		{"reachability with fireability", []formula{modal(A, G, cardinality), modal(E, F, fireable("t0"))}, "ReachabilityFireability"},
+		{"LTL", []formula{modal(A, X, fireable("t0")), modal(A, U, fireable("t0"), fireable("t1"))}, "LTLFireability"},
+		{"LTL and reachability", []formula{modal(A, X, cardinality), modal(A, G, cardinality)}, "CTLCardinality"},
+		{"CTL", []formula{modal(A, G, modal(E, F, cardinality))}, "CTLCardinality"},
+		{"CTL and LTL", []formula{modal(E, X, fireable("t0")), modal(A, X, fireable("t0"))}, "CTLFireability"},
+		{"bounds and others", []formula{placeBound("p0"), modal(A, G, cardinality)}, "CTLCardinality"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if examination := examinationOf(test.formulas); examination != test.examination {
+				t.Errorf("examination %s, expected %s", examination, test.examination)
+			}
+		})
+	}
+}
+
+func TestParseBenchKitOutput(t *testing.T) {
+	indices := map[string]int{
+		"Toy-PT-001-ForFiltering-00": 0,
+		"Toy-PT-001-ForFiltering-01": 1,
+		"Toy-PT-001-ForFiltering-02": 2,
+	}
+	tests := []struct {
+		name     string
+		output   string
+		expected []checkerResult
+	}{
+		{"empty output", "", []checkerResult{}},
+		{
+			"verdicts",
+			"FORMULA Toy-PT-001-ForFiltering-00 TRUE TECHNIQUES EXPLICIT\n" +
+				"FORMULA Toy-PT-001-ForFiltering-01 FALSE TECHNIQUES SEQUENTIAL_PROCESSING  DECISION_DIAGRAMS\n",
+			[]checkerResult{
+				{index: 0, verdict: trueVerdict, states: -1, technique: "EXPLICIT"},
+				{index: 1, verdict: falseVerdict, states: -1, technique: "SEQUENTIAL_PROCESSING DECISION_DIAGRAMS"},
+			},
+		},
+		{
+			"bound",
+			"FORMULA Toy-PT-001-ForFiltering-02 3 TECHNIQUES TOPOLOGICAL\n",
+			[]checkerResult{{index: 2, verdict: boundVerdict, bound: 3, states: -1, technique: "TOPOLOGICAL"}},
+		},
+		{
+			"no technique",
+			"FORMULA Toy-PT-001-ForFiltering-00 TRUE TECHNIQUES\n",
+			[]checkerResult{{index: 0, verdict: trueVerdict, states: -1, technique: ""}},
+		},
+		{
+			"cannot compute",
+			"FORMULA Toy-PT-001-ForFiltering-00 CANNOT_COMPUTE TECHNIQUES EXPLICIT\n" +
+				"CANNOT_COMPUTE\n" +
+				"DO_NOT_COMPETE\n",
+			[]checkerResult{},
+		},
+		{
+			"ids not in the batch",
+			"FORMULA Toy-PT-001-ForFiltering-03 TRUE TECHNIQUES EXPLICIT\n" +
+				"FORMULA Other-PT-001-ForFiltering-00 TRUE TECHNIQUES EXPLICIT\n" +
+				"FORMULA Toy-PT-001-ForFiltering-01 TRUE TECHNIQUES EXPLICIT\n",
+			[]checkerResult{{index: 1, verdict: trueVerdict, states: -1, technique: "EXPLICIT"}},
+		},
+		{
+			"other lines",
+			"Loading model\n" +
+				"  FORMULA Toy-PT-001-ForFiltering-00 TRUE TECHNIQUES EXPLICIT\n" +
+				"FORMULA Toy-PT-001-ForFiltering-00 TRUE\n" +
+				"FORMULA Toy-PT-001-ForFiltering-02 TRUE TECHNIQUESX\n",
+			[]checkerResult{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			results, err := parseBenchKitOutput(strings.NewReader(test.output), indices)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(results, test.expected) {
+				t.Errorf("results %+v, expected %+v", results, test.expected)
+			}
+		})
+	}
+}
+
+// a BenchKit checker answering for the first formula of the batch, and then
+// starting a process that runs past the timeout
+func sleepingChecker(t *testing.T) string {
+	t.Helper()
+	script := filepath.Join(t.TempDir(), "checker.sh")
+	content := "echo 'FORMULA Toy-PT-001-ForFiltering-2024-00 TRUE TECHNIQUES STUB'\nsleep 30\n"
+	if err := os.WriteFile(script, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return script
+}
+
+func TestRunCheckerTimeout(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the timeout")
+	}
+	setTestConfig(t, func(c *config) {
+		c.CheckerTimeout = 1
+		c.SMClogfile = filepath.Join(t.TempDir(), "smclog")
+	})
+	indices := map[string]int{"Toy-PT-001-ForFiltering-2024-00": 0}
+	start := time.Now()
+	results, err := runChecker([]string{"sh", sleepingChecker(t)}, nil, 3, "job", log.New(io.Discard, "", 0), func(out io.Reader) ([]checkerResult, error) {
+		return parseBenchKitOutput(out, indices)
+	})
+	// the sleep started by the checker is killed with it
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("stopped after %v", elapsed)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []checkerResult{
+		{index: 0, verdict: trueVerdict, states: -1, technique: "STUB"},
+		{index: 1, verdict: unknownVerdict, states: -1, timedOut: true},
+		{index: 2, verdict: unknownVerdict, states: -1, timedOut: true},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("results %+v, expected %+v", results, expected)
+	}
+}
+
+// formulas without verdict when the checker times out are hard or skipped,
+// according to the timeout policy
+func TestTimeoutPolicy(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for the timeout")
+	}
+	A, E := allPathsOperator, existsPathOperator
+	G, F := globallyOperator, finallyOperator
+	formulas := []formula{modal(E, F, fireable("t1")), modal(A, G, fireable("t0"))}
+	for _, test := range []struct {
+		policy string
+		status filterStatus
+	}{
+		{"hard", hard},
+		{"unknown", skipped},
+	} {
+		t.Run(test.policy, func(t *testing.T) {
+			dir := t.TempDir()
+			script := sleepingChecker(t)
+			setTestConfig(t, func(c *config) {
+				c.Checker = "benchkit"
+				c.CheckerCommand = "sh " + script + " {formulas}"
+				c.CheckerTimeout = 1
+				c.TimeoutPolicy = test.policy
+				c.SMCTmpFileName = filepath.Join(dir, "tmp")
+				c.SMClogfile = filepath.Join(dir, "smclog")
+			})
+			m := &modelInfo{modelName: "Toy", modelType: pt, modelInstance: "001", filePath: filepath.Join(dir, "model.pnml"), net: cycleNet()}
+			results, err := m.filter(formulas, len(formulas), 100, true, log.New(io.Discard, "", 0), "job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if results[0].status != decided || results[0].verdict != trueVerdict {
+				t.Errorf("first formula %v %v, expected decided TRUE", results[0].status, results[0].verdict)
+			}
+			if results[1].status != test.status {
+				t.Errorf("timed out formula %v, expected %v", results[1].status, test.status)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"github.com/loig/pinimili/pnml"
+)
+
+// largest finite int range that is enumerated
+const maxRangeSize int = 1 << 16
+
+// a finite sort of colors of a colored net
+type colorSort struct {
+	kind       string       // dot, bool, enumeration, cyclic, range or product
+	constants  []string     // ids of the colors of the sort (values for ranges)
+	names      []string     // names of the colors of the sort (same as ids when they have none)
+	components []*colorSort // sorts of the components of the colors of a product
+	labels     map[string]bool
+}
+
+// sorts and variables declared in a colored net
+type colorDeclarations struct {
+	namedSorts    map[string]*pnml.HLSort
+	sorts         map[string]*colorSort
+	variables     map[string]*pnml.HLSort
+	variableOrder map[string]int
+	constants     map[string]colorComponent // constants of enumerations, by id
+}
+
+func newColorDeclarations(p *pnml.Pnml) *colorDeclarations {
+	d := colorDeclarations{
+		namedSorts:    make(map[string]*pnml.HLSort),
+		sorts:         make(map[string]*colorSort),
+		variables:     make(map[string]*pnml.HLSort),
+		variableOrder: make(map[string]int),
+		constants:     make(map[string]colorComponent),
+	}
+
+	declarations := make([]pnml.HLDeclaration, 0)
+	for _, n := range p.Nets {
+		declarations = append(declarations, n.HLDeclarations...)
+	}
+	for _, pa := range allPages(p) {
+		declarations = append(declarations, pa.HLDeclarations...)
+	}
+
+	for _, decl := range declarations {
+		for _, s := range decl.SortDeclarations {
+			d.namedSorts[*s.ID] = s.Sort
+		}
+		for _, v := range decl.VariableDeclarations {
+			d.variables[*v.ID] = v.Sort
+			d.variableOrder[*v.ID] = len(d.variableOrder)
+		}
+	}
+
+	// resolve the named sorts, so that all the constants are known
+	for id := range d.namedSorts {
+		d.resolve(&pnml.HLSort{Type: "usersort", Value: pnml.HLUserSort{ID: &id}}, 0)
+	}
+
+	return &d
+}
+
+// the finite sort corresponding to a sort of the pnml model
+func (d *colorDeclarations) sort(h *pnml.HLSort) (*colorSort, error) {
+	return d.resolve(h, 0)
+}
+
+func (d *colorDeclarations) resolve(h *pnml.HLSort, depth int) (*colorSort, error) {
+	switch v := h.Value.(type) {
+	case pnml.DotSort:
+		return &colorSort{kind: "dot", constants: []string{"dot"}, names: []string{"dot"}}, nil
+	case pnml.BoolSort:
+		return &colorSort{kind: "bool", constants: []string{"false", "true"}, names: []string{"false", "true"}}, nil
+	case pnml.FESort:
+		return d.enumerationSort("enumeration", v.Constants), nil
+	case pnml.CyclicEnumSort:
+		return d.enumerationSort("cyclic", v.Constants), nil
+	case pnml.FIRSort:
+		if v.Start == nil || v.End == nil || *v.End-*v.Start >= maxRangeSize {
+			return nil, fmt.Errorf("unsupported finite int range")
+		}
+		s := colorSort{kind: "range"}
+		for i := *v.Start; i <= *v.End; i++ {
+			s.constants = append(s.constants, strconv.Itoa(i))
+		}
+		s.names = s.constants
+		return &s, nil
+	case pnml.HLProductSort:
+		s := colorSort{kind: "product"}
+		for i := range v.Sorts {
+			c, err := d.resolve(&v.Sorts[i], depth)
+			if err != nil {
+				return nil, err
+			}
+			s.components = append(s.components, c)
+		}
+		return &s, nil
+	case pnml.HLUserSort:
+		id := *v.ID
+		if s, found := d.sorts[id]; found {
+			return s, nil
+		}
+		named, found := d.namedSorts[id]
+		if !found {
+			return nil, fmt.Errorf("unknown sort %s", id)
+		}
+		if depth > len(d.namedSorts) {
+			return nil, fmt.Errorf("recursive sort %s", id)
+		}
+		s, err := d.resolve(named, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		d.sorts[id] = s
+		return s, nil
+	}
+	return nil, fmt.Errorf("unsupported sort %s", h.Type)
+}
+
+func (d *colorDeclarations) enumerationSort(kind string, constants []pnml.FEConstant) *colorSort {
+	s := colorSort{kind: kind}
+	for i, c := range constants {
+		d.constants[*c.ID] = colorComponent{sort: &s, index: i}
+		s.constants = append(s.constants, *c.ID)
+		name := *c.ID
+		if c.Name != nil {
+			name = *c.Name
+		}
+		s.names = append(s.names, name)
+	}
+	return &s
+}
+
+// the non-product sorts making a sort, dots are left out as they
+// do not appear in the names of unfolded nodes
+func (s *colorSort) flatten() []*colorSort {
+	switch s.kind {
+	case "dot":
+		return nil
+	case "product":
+		flat := make([]*colorSort, 0)
+		for _, c := range s.components {
+			flat = append(flat, c.flatten()...)
+		}
+		return flat
+	}
+	return []*colorSort{s}
+}
+
+// the ways a color of a non-product sort may be written in the
+// id of an unfolded node: its id or its name
+func (s *colorSort) isLabel(label string) bool {
+	if s.labels == nil {
+		s.labels = make(map[string]bool)
+		for i := range s.constants {
+			s.labels[s.constants[i]] = true
+			s.labels[s.names[i]] = true
+		}
+	}
+	return s.labels[label]
+}
+
+// checks if a string is a sequence of colors of the given sorts, separated
+// by _, as used by the MCC unfolder for naming unfolded nodes
+func matchColors(colors string, sorts []*colorSort) bool {
+	if len(sorts) == 0 {
+		return colors == ""
+	}
+	if len(sorts) == 1 {
+		return sorts[0].isLabel(colors)
+	}
+	for i := 0; i < len(colors); i++ {
+		if colors[i] == '_' && sorts[0].isLabel(colors[:i]) && matchColors(colors[i+1:], sorts[1:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// color domains of the places and transitions of a colored net: the
+// sorts of the colors of places and the sorts of the variables of
+// transitions (in order of declaration), nodes for which the domain
+// cannot be computed are left out
+func colorDomains(p *pnml.Pnml) (places, transitions map[string][]*colorSort) {
+	d := newColorDeclarations(p)
+	pages := allPages(p)
+	resolve := referenceResolver(pages)
+
+	places = make(map[string][]*colorSort)
+	transitions = make(map[string][]*colorSort)
+
+	variables := d.transitionVariables(pages, resolve)
+
+	for _, pa := range pages {
+		for _, pl := range pa.Places {
+			if pl.Type == nil || pl.Type.Structure == nil || pl.Type.Structure.Sort == nil {
+				places[*pl.ID] = nil
+				continue
+			}
+			s, err := d.sort(pl.Type.Structure.Sort)
+			if err == nil {
+				places[*pl.ID] = s.flatten()
+			}
+		}
+		for _, tr := range pa.Transitions {
+			domain := make([]*colorSort, 0)
+			supported := true
+			for _, v := range variables[*tr.ID] {
+				h, declared := d.variables[v]
+				if !declared {
+					supported = false
+					break
+				}
+				s, err := d.sort(h)
+				if err != nil {
+					supported = false
+					break
+				}
+				domain = append(domain, s.flatten()...)
+			}
+			if supported {
+				transitions[*tr.ID] = domain
+			}
+		}
+	}
+
+	return places, transitions
+}
+
+// variables used by transitions, in guards and on adjacent arcs, in
+// order of declaration
+func (d *colorDeclarations) transitionVariables(pages []pnml.Page, resolve func(string) string) map[string][]string {
+	found := make(map[string]map[string]bool)
+	for _, pa := range pages {
+		for _, tr := range pa.Transitions {
+			found[*tr.ID] = make(map[string]bool)
+			if tr.Condition != nil {
+				collectVariables(reflect.ValueOf(tr.Condition), found[*tr.ID])
+			}
+		}
+	}
+	for _, pa := range pages {
+		for _, a := range pa.Arcs {
+			if a.HLInscription == nil {
+				continue
+			}
+			for _, end := range []string{resolve(*a.Source), resolve(*a.Target)} {
+				if vars, isTransition := found[end]; isTransition {
+					collectVariables(reflect.ValueOf(a.HLInscription), vars)
+				}
+			}
+		}
+	}
+
+	variables := make(map[string][]string)
+	for t, vars := range found {
+		variables[t] = make([]string, 0, len(vars))
+		for v := range vars {
+			variables[t] = append(variables[t], v)
+		}
+		sort.Slice(variables[t], func(i, j int) bool { return d.variableOrder[variables[t][i]] < d.variableOrder[variables[t][j]] })
+	}
+	return variables
+}
+
+// find the variables appearing in a part of a pnml model
+func collectVariables(v reflect.Value, found map[string]bool) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectVariables(v.Elem(), found)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			collectVariables(v.Index(i), found)
+		}
+	case reflect.Struct:
+		if variable, isVariable := v.Interface().(pnml.HLVariable); isVariable {
+			if variable.ID != nil {
+				found[*variable.ID] = true
+			}
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			collectVariables(v.Field(i), found)
+		}
+	}
+}
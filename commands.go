@@ -0,0 +1,293 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type command struct {
+	name        string
+	description string
+	run         func(args []string)
+}
+
+var commands []command = []command{
+	{"generate", "generate formulas for all the models (default command)", generateCommand},
+	{"list-models", "list the models found in the input directory", listModelsCommand},
+	{"map", "show the mapping of nodes from COL models to their PT twins", mapCommand},
+	{"filter", "filter a set of formulas for a model, keeping the hard ones", filterCommand},
+	{"unfold", "unfold a set of formulas from a COL model to its PT twin", unfoldCommand},
+	{"check", "model check a set of formulas on a model", checkCommand},
+	{"stats", "show statistics about the models", statsCommand},
+	{"convert", "convert a property file between xml and human-readable formats", convertCommand},
+}
+
+// flags common to all the commands working on models
+func commandFlags(name string) (*flag.FlagSet, *string) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	configFile := flags.String("conf", "config.json", "path to the configuration file")
+	return flags, configFile
+}
+
+// models of the input directory, sorted by name
+func sortedModels() []*modelInfo {
+	models := selectModels(listModels(globalConfiguration.InputDir))
+	sort.Slice(models, func(i, j int) bool { return models[i].name() < models[j].name() })
+	return models
+}
+
+// find a model by its name and prepare it (and its twin) for use
+func selectModel(name string, logger *log.Logger) (m *modelInfo, canUnfold bool) {
+	if name == "" {
+		log.Fatal("No model given, use -model")
+	}
+	for _, mm := range listModels(globalConfiguration.InputDir) {
+		if mm.name() == name {
+			return mm, mm.prepare(logger)
+		}
+		if mm.twinModel != nil && mm.twinModel.name() == name {
+			return mm.twinModel, mm.prepare(logger)
+		}
+	}
+	log.Fatal("No model named ", name, " in ", globalConfiguration.InputDir)
+	return nil, false
+}
+
+// list the models found in the input directory
+func listModelsCommand(args []string) {
+
+	flags, configFile := commandFlags("list-models")
+	selection := addModelSelectionFlags(flags)
+	flags.Parse(args)
+	getConfig(*configFile)
+	selection.apply()
+
+	for _, m := range sortedModels() {
+		if m.twinModel != nil {
+			fmt.Println(m.name(), "(twin:", m.twinModel.name()+")")
+			continue
+		}
+		fmt.Println(m.name())
+	}
+}
+
+// show the mapping of nodes from COL models to their PT twins
+// (or to their native unfolding for COL models without twin)
+func mapCommand(args []string) {
+
+	flags, configFile := commandFlags("map")
+	selection := addModelSelectionFlags(flags)
+	modelName := flags.String("model", "", "name of the COL model to consider (default: all the COL models)")
+	flags.Parse(args)
+	getConfig(*configFile)
+	selection.apply()
+	writeModelFiles = false
+
+	logger := log.Default()
+	for _, m := range sortedModels() {
+		if m.modelType != col {
+			continue
+		}
+		if *modelName != "" && m.name() != *modelName {
+			continue
+		}
+		canUnfold := m.prepare(logger)
+		if m.twinModel == nil {
+			fmt.Println("Model", m.name(), "-> native unfolding")
+			if !canUnfold {
+				fmt.Println("  impossible unfolding")
+				continue
+			}
+			printMapping("place", append(append([]string{}, m.places...), m.excludedPlaces...), m.unmappedPlaces, m.placesMapping)
+			printMapping("transition", append(append([]string{}, m.transitions...), m.excludedTransitions...), m.unmappedTransitions, m.transitionsMapping)
+			continue
+		}
+		fmt.Println("Model", m.name(), "->", m.twinModel.name())
+		if r := m.twinModel.mappingReport; r != nil {
+			fmt.Println(" ", r.summary())
+			for _, line := range r.details() {
+				fmt.Println(" ", line)
+			}
+		}
+		if !canUnfold {
+			fmt.Println("  impossible mapping")
+			continue
+		}
+		printMapping("place", append(append([]string{}, m.places...), m.excludedPlaces...), m.unmappedPlaces, m.twinModel.placesMapping)
+		printMapping("transition", append(append([]string{}, m.transitions...), m.excludedTransitions...), m.unmappedTransitions, m.twinModel.transitionsMapping)
+	}
+}
+
+func printMapping(kind string, mapped, unmapped []string, mapping map[string][]string) {
+	for _, n := range mapped {
+		fmt.Println(" ", kind, n, "->", strings.Join(mapping[n], " "))
+	}
+	for _, n := range unmapped {
+		fmt.Println(" ", kind, n, "-> (unmapped)")
+	}
+}
+
+// flags and formulas for the commands working on a set of formulas of a model,
+// the -out flag is only available if its usage is given
+func formulasCommand(name string, args []string, outUsage string) (m *modelInfo, canUnfold bool, properties []property, outFile string) {
+
+	flags, configFile := commandFlags(name)
+	modelName := flags.String("model", "", "name of the model to consider")
+	formulasFile := flags.String("formulas", "", "property file to read (.xml for MCC format, .txt for human-readable format)")
+	if outUsage != "" {
+		flags.StringVar(&outFile, "out", "", outUsage)
+	}
+	flags.Parse(args)
+	getConfig(*configFile)
+
+	if *formulasFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	properties, err := readProperties(*formulasFile)
+	if err != nil {
+		log.Fatal("Error when reading formulas: ", err)
+	}
+
+	m, canUnfold = selectModel(*modelName, log.Default())
+	return m, canUnfold, properties, outFile
+}
+
+func propertiesFormulas(properties []property) []formula {
+	formulas := make([]formula, len(properties))
+	for i, p := range properties {
+		formulas[i] = p.formula
+	}
+	return formulas
+}
+
+// filter a set of formulas for a model, keeping the hard ones
+func filterCommand(args []string) {
+
+	m, canUnfold, properties, outFile := formulasCommand("filter", args, "property file where to write the kept formulas (optional)")
+
+	results, err := m.filter(propertiesFormulas(properties), len(properties), globalConfiguration.SMCMaxStates, canUnfold, log.Default(), "filter")
+	if err != nil {
+		log.Fatal("Error when filtering formulas: ", err)
+	}
+	toKeep := hardFormulas(results)
+	kept := make([]property, len(toKeep))
+	for i, k := range toKeep {
+		kept[i] = properties[k]
+		fmt.Println(properties[k].id)
+	}
+
+	if outFile != "" {
+		writeProperties(kept, outFile, log.Default())
+	}
+}
+
+// unfold a set of formulas from a COL model to its PT twin
+func unfoldCommand(args []string) {
+
+	m, canUnfold, properties, outFile := formulasCommand("unfold", args, "property file where to write the unfolded formulas")
+
+	if m.modelType != col || m.twinModel == nil || !canUnfold {
+		log.Fatal("Cannot unfold formulas: ", m.name(), " is not a COL model with a PT twin and a correct mapping")
+	}
+	if outFile == "" {
+		log.Fatal("No output file given, use -out")
+	}
+
+	prefix := m.name() + "-"
+	twinPrefix := m.twinModel.name() + "-"
+	for i := range properties {
+		properties[i].id = strings.Replace(properties[i].id, prefix, twinPrefix, 1)
+		properties[i].formula = m.twinModel.unfolding(properties[i].formula)
+	}
+	writeProperties(properties, outFile, log.Default())
+}
+
+// model check a set of formulas on a model (on its PT twin or its native unfolding for COL models)
+func checkCommand(args []string) {
+
+	m, canUnfold, properties, _ := formulasCommand("check", args, "")
+
+	formulas := propertiesFormulas(properties)
+	if m.modelType == col {
+		if !canUnfold {
+			log.Fatal("Cannot check formulas: ", m.name(), " cannot be unfolded")
+		}
+		for i := range formulas {
+			formulas[i] = m.unfoldingModel().unfolding(formulas[i])
+		}
+	}
+
+	net, err := m.ptNet()
+	if err != nil {
+		log.Fatal("Error when checking formulas: ", err)
+	}
+	results := net.check(formulas, globalConfiguration.SMCMaxStates)
+	for i, r := range results {
+		if r.err != nil {
+			fmt.Println(properties[i].id, "UNCHECKED", r.err)
+			continue
+		}
+		if r.verdict == boundVerdict {
+			fmt.Println(properties[i].id, r.bound)
+			continue
+		}
+		fmt.Println(properties[i].id, r.verdict)
+	}
+}
+
+// show statistics about the models
+func statsCommand(args []string) {
+
+	flags, configFile := commandFlags("stats")
+	selection := addModelSelectionFlags(flags)
+	modelName := flags.String("model", "", "name of the model to consider (default: all the models)")
+	flags.Parse(args)
+	getConfig(*configFile)
+	selection.apply()
+	writeModelFiles = false
+
+	logger := log.Default()
+	for _, m := range sortedModels() {
+		if *modelName != "" && m.name() != *modelName && (m.twinModel == nil || m.twinModel.name() != *modelName) {
+			continue
+		}
+		canUnfold := m.prepare(logger)
+		printStats(m)
+		if m.twinModel != nil {
+			printStats(m.twinModel)
+			fmt.Println("  unfolding:", canUnfold)
+		}
+	}
+}
+
+func printStats(m *modelInfo) {
+	fmt.Println(m.name())
+	fmt.Printf("  places: %d (unmapped: %d, constant: %d)\n", len(m.places)+len(m.unmappedPlaces)+len(m.excludedPlaces), len(m.unmappedPlaces), len(m.excludedPlaces))
+	fmt.Printf("  transitions: %d (unmapped: %d, dead: %d)\n", len(m.transitions)+len(m.unmappedTransitions)+len(m.excludedTransitions), len(m.unmappedTransitions), len(m.excludedTransitions))
+	if m.modelType == pt {
+		fmt.Println("  maximum constant in marking:", m.maxConstantInMarking)
+	}
+}
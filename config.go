@@ -14,11 +14,33 @@ type config struct {
 	MinIntegerConstant     int
 	MaxIntegerConstant     int
 	InputDir               string
+	IncludeModels          []string
+	ExcludeModels          []string
+	ModelTypes             []string
 	NumFormulas            int
+	Examinations           []string
 	NumUnfold              int
+	MappingFile            string
+	StructuralAnalysis     bool
+	StructureFile          string
 	FormulaDepth           int
 	MaxFilterTries         int
+	ParallelRounds         int
 	FilterSetSize          int
+	StateBudgetGrowth      float64
+	MaxStateBudget         int
+	DepthGrowth            int
+	MaxFormulaDepth        int
+	Fallback               string
+	Checker                string
+	CheckerCommand         string
+	CheckerTimeout         int
+	CheckerMemory          int
+	TimeoutPolicy          string
+	UnknownShare           float64
+	MinTrueShare           float64
+	MinFalseShare          float64
+	Selection              string
 	SMCPath                string
 	SMCTmpFileName         string
 	SMClogfile             string
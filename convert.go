@@ -0,0 +1,71 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// convert a property file from MCC xml format to human-readable format
+// or the other way around, formats are given by files extensions
+func convertCommand(args []string) {
+
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	inFile := flags.String("in", "", "property file to read (.xml for MCC format, .txt for human-readable format)")
+	outFile := flags.String("out", "", "property file to write (.xml for MCC format, .txt for human-readable format)")
+	flags.Parse(args)
+
+	if *inFile == "" || *outFile == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	properties, err := readProperties(*inFile)
+	if err != nil {
+		log.Fatal("Error when reading formulas: ", err)
+	}
+
+	writeProperties(properties, *outFile, log.Default())
+	log.Print("Converted ", len(properties), " formulas from ", *inFile, " to ", *outFile)
+}
+
+// checks if a property file is in MCC xml format (and not in human-readable format)
+func isxmlFile(filePath string) bool {
+	return filepath.Ext(filePath) == ".xml"
+}
+
+// read a property file in MCC xml format or in human-readable format
+func readProperties(filePath string) ([]property, error) {
+	if isxmlFile(filePath) {
+		return readxmlFormulas(filePath)
+	}
+	return readhrFormulas(filePath)
+}
+
+// write a property file in MCC xml format or in human-readable format
+func writeProperties(properties []property, filePath string, logger *log.Logger) {
+	if isxmlFile(filePath) {
+		writexmlProperties(properties, filePath, logger)
+		return
+	}
+	writehrProperties(properties, filePath, logger)
+}
@@ -0,0 +1,145 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// difficulty of a formula, measured when filtering it
+type difficulty struct {
+	states int     // states explored before a verdict (the budget if undecided), -1 if not known
+	budget int     // states the model checker could explore
+	size   int     // number of operators of the formula
+	depth  int     // nesting depth of the operators of the formula
+	score  float64 // between 0 (easy) and 1 (hard), -1 if not known
+}
+
+// difficulty of a formula given its filtering: the score is the number of
+// states explored, on a log scale relative to the state budget
+func newDifficulty(f formula, r filterResult, budget int) difficulty {
+	d := difficulty{states: r.states, budget: budget, size: f.size(), depth: f.depth(), score: -1}
+	switch r.status {
+	case trivial:
+		d.states = 1
+	case hard:
+		d.states = budget
+	}
+	if d.states < 0 {
+		return d
+	}
+	d.score = 1
+	if d.states < budget {
+		d.score = math.Log1p(float64(d.states)) / math.Log1p(float64(budget))
+	}
+	return d
+}
+
+// checks if a formula is easier than another one: fewer states, and then
+// smaller and less deep formulas
+func (d difficulty) easierThan(e difficulty) bool {
+	if d.score != e.score {
+		return d.score < e.score
+	}
+	if d.size != e.size {
+		return d.size < e.size
+	}
+	return d.depth < e.depth
+}
+
+// number of operators of a formula (names of nodes and constants are not counted)
+func (f formula) size() int {
+	if len(f.operand) == 0 {
+		return 0
+	}
+	size := 1
+	for _, g := range f.operand {
+		size += g.size()
+	}
+	return size
+}
+
+// nesting depth of the operators of a formula
+func (f formula) depth() int {
+	if len(f.operand) == 0 {
+		return 0
+	}
+	depth := 0
+	for _, g := range f.operand {
+		if d := g.depth(); d > depth {
+			depth = d
+		}
+	}
+	return depth + 1
+}
+
+// set the difficulty of formulas filtered with a given state budget
+func setDifficulties(formulas []formula, results []filterResult, budget int) {
+	for i := range results {
+		results[i].difficulty = newDifficulty(formulas[i], results[i], budget)
+	}
+}
+
+// checks that the configured selection strategy exists
+func checkSelection() error {
+	switch globalConfiguration.Selection {
+	case "first", "hardest", "spread":
+		return nil
+	}
+	return fmt.Errorf("unknown selection strategy %q (first, hardest or spread)", globalConfiguration.Selection)
+}
+
+// order in which candidates are considered for selection, according to the
+// configured strategy: the order of generation (first), the hardest ones
+// first (hardest), or, for numFormulas formulas, candidates evenly spread
+// from the easiest to the hardest first and then the other ones (spread)
+func orderCandidates(candidates []candidate, numFormulas int) []candidate {
+	ordered := make([]candidate, len(candidates))
+	copy(ordered, candidates)
+	switch globalConfiguration.Selection {
+	case "hardest":
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[j].result.difficulty.easierThan(ordered[i].result.difficulty)
+		})
+	case "spread":
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].result.difficulty.easierThan(ordered[j].result.difficulty)
+		})
+		if numFormulas <= 1 || len(ordered) <= numFormulas {
+			break
+		}
+		spread := make([]candidate, 0, len(ordered))
+		rest := make([]candidate, 0, len(ordered))
+		picked := make([]bool, len(ordered))
+		for k := 0; k < numFormulas; k++ {
+			picked[int(math.Round(float64(k*(len(ordered)-1))/float64(numFormulas-1)))] = true
+		}
+		for i, c := range ordered {
+			if picked[i] {
+				spread = append(spread, c)
+			} else {
+				rest = append(rest, c)
+			}
+		}
+		ordered = append(spread, rest...)
+	}
+	return ordered
+}
@@ -0,0 +1,134 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestNewDifficulty(t *testing.T) {
+	f := modal(allPathsOperator, globallyOperator, leq(tokens("p0"), integer(1)))
+	tests := []struct {
+		name   string
+		result filterResult
+		states int
+		score  float64
+	}{
+		{"trivial", filterResult{status: trivial, states: -1}, 1, math.Log(2) / math.Log(101)},
+		{"decided", filterResult{status: decided, states: 10}, 10, math.Log(11) / math.Log(101)},
+		{"decided with the whole budget", filterResult{status: decided, states: 100}, 100, 1},
+		{"decided beyond the budget", filterResult{status: decided, states: 150}, 150, 1},
+		{"decided without states", filterResult{status: decided, states: -1}, -1, -1},
+		{"hard", filterResult{status: hard, states: 30}, 100, 1},
+		{"not checked", filterResult{status: skipped, states: -1}, -1, -1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := newDifficulty(f, test.result, 100)
+			if d.states != test.states || math.Abs(d.score-test.score) > 1e-9 {
+				t.Errorf("%d states scored %v, expected %d scored %v", d.states, d.score, test.states, test.score)
+			}
+			if d.budget != 100 || d.size != 5 || d.depth != 4 {
+				t.Errorf("budget %d, size %d and depth %d, expected 100, 5 and 4", d.budget, d.size, d.depth)
+			}
+		})
+	}
+}
+
+// candidates named by a letter, with a difficulty given by their score, then
+// their size
+func difficultyCandidates(scores []float64, sizes []int) []candidate {
+	candidates := make([]candidate, len(scores))
+	for i := range scores {
+		candidates[i] = candidate{
+			formula: fireable(string(rune('a' + i))),
+			result:  filterResult{status: decided, difficulty: difficulty{score: scores[i], size: sizes[i]}},
+		}
+	}
+	return candidates
+}
+
+func candidateNames(candidates []candidate) string {
+	names := make([]byte, len(candidates))
+	for i, c := range candidates {
+		names[i] = c.formula.operand[0].operator.name[0]
+	}
+	return string(names)
+}
+
+func TestOrderCandidates(t *testing.T) {
+	//                  a    b    c    d    e    f    g
+	scores := []float64{0.5, 0.1, 0.9, 0.5, 0.3, -1, 0.7}
+	sizes := []int{3, 3, 3, 5, 3, 3, 3}
+	tests := []struct {
+		selection   string
+		numFormulas int
+		order       string
+	}{
+		{"first", 3, "abcdefg"},
+		{"hardest", 3, "cgdaebf"},
+		{"spread", 3, "facbedg"},
+		{"spread", 4, "fedcbag"},
+		{"spread", 7, "fbeadgc"},
+		{"spread", 1, "fbeadgc"},
+	}
+	for _, test := range tests {
+		t.Run(fmt.Sprint(test.selection, "-", test.numFormulas), func(t *testing.T) {
+			setTestConfig(t, func(c *config) { c.Selection = test.selection })
+			candidates := difficultyCandidates(scores, sizes)
+			if order := candidateNames(orderCandidates(candidates, test.numFormulas)); order != test.order {
+				t.Errorf("order %s for %d formulas, expected %s", order, test.numFormulas, test.order)
+			}
+			if candidateNames(candidates) != "abcdefg" {
+				t.Error("candidates reordered in place")
+			}
+		})
+	}
+}
+
+// the formulas selected are the ones given by the selection strategy
+func TestGenerationSelection(t *testing.T) {
+	for selection, expected := range map[string][]int{
+		"first":  {0, 1, 2},
+		"spread": {0, 3, 6},
+	} {
+		t.Run(selection, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.Selection = selection
+				c.UnknownShare = 0
+				c.FilterSetSize = 7
+				c.MaxFilterTries = 1
+				c.SMCMaxStates = 100
+			})
+			// formulas of the same difficulty, kept in the order of generation
+			g := newScriptedGeneration(map[int]string{2: "TTTTTTT"})
+			formulas, _, err := scriptedFormulas(t, 3, 2, g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, n := range expected {
+				if want := modal(existsPathOperator, finallyOperator, leq(integer(n+1), tokens("p0"))); formulas[i].key() != want.key() {
+					t.Errorf("formula %d is %s, expected %s", i, formulas[i].key(), want.key())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "fmt"
+
+// state budget and depth of formulas used for a filtering round, changed
+// between rounds when the rounds keep too few formulas
+type escalation struct {
+	budget int
+	depth  int
+}
+
+func newEscalation(depth int) escalation {
+	return escalation{budget: globalConfiguration.SMCMaxStates, depth: depth}
+}
+
+// checks that the configured escalation policy and fallback exist
+func checkEscalation() error {
+	if globalConfiguration.StateBudgetGrowth < 1 {
+		return fmt.Errorf("StateBudgetGrowth must be at least 1, got %v", globalConfiguration.StateBudgetGrowth)
+	}
+	if globalConfiguration.DepthGrowth < 0 {
+		return fmt.Errorf("DepthGrowth must be positive, got %v", globalConfiguration.DepthGrowth)
+	}
+	switch globalConfiguration.Fallback {
+	case "random", "shallower", "fail":
+		return nil
+	}
+	return fmt.Errorf("unknown fallback %q (random, shallower or fail)", globalConfiguration.Fallback)
+}
+
+// change the budget and the depth after a round, given the formulas fitting
+// the mix of verdicts before and after the round, when the formulas kept at
+// this pace would not fill the mix in the rounds left: a larger budget for
+// getting more decided formulas (only if hard formulas are not missing, as
+// it gives fewer of them), deeper formulas for getting more hard ones
+func (e *escalation) update(before, after verdictMix, roundsLeft int) (changed bool) {
+	missingHard, missingDecided := after.hard-after.numHard, after.decided-after.numDecided
+	keptHard, keptDecided := after.numHard-before.numHard, after.numDecided-before.numDecided
+
+	if missingDecided > 0 && missingHard == 0 && keptDecided*roundsLeft < missingDecided {
+		budget := int(float64(e.budget) * globalConfiguration.StateBudgetGrowth)
+		if limit := globalConfiguration.MaxStateBudget; limit > 0 && budget > limit {
+			budget = limit
+		}
+		changed = changed || budget != e.budget
+		e.budget = budget
+	}
+
+	if missingHard > 0 && keptHard*roundsLeft < missingHard {
+		depth := e.depth + globalConfiguration.DepthGrowth
+		if limit := globalConfiguration.MaxFormulaDepth; limit > 0 && depth > limit {
+			depth = limit
+		}
+		changed = changed || depth != e.depth
+		e.depth = depth
+	}
+	return changed
+}
@@ -0,0 +1,65 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "testing"
+
+// the state budget grows when decided formulas are missing, the depth when
+// hard ones are, only when the rounds keep too few of them for the rounds left
+func TestEscalationUpdate(t *testing.T) {
+	tests := []struct {
+		name                string
+		budget, depth       int
+		numHard, numDecided int // formulas kept by the round
+		roundsLeft          int
+		expectedBudget      int
+		expectedDepth       int
+		changed             bool
+	}{
+		{"on pace", 50, 3, 1, 1, 2, 50, 3, false},
+		{"mix filled", 50, 3, 3, 3, 1, 50, 3, false},
+		{"decided missing", 50, 3, 3, 1, 1, 100, 3, true},
+		{"budget capped", 100, 3, 3, 1, 1, 150, 3, true},
+		{"budget at its limit", 150, 3, 3, 1, 1, 150, 3, false},
+		{"hard missing", 50, 3, 1, 3, 1, 50, 4, true},
+		{"no larger budget when hard formulas are missing", 50, 3, 0, 0, 1, 50, 4, true},
+		{"depth at its limit", 50, 5, 0, 3, 1, 50, 5, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.StateBudgetGrowth = 2
+				c.MaxStateBudget = 150
+				c.DepthGrowth = 1
+				c.MaxFormulaDepth = 5
+			})
+			e := escalation{budget: test.budget, depth: test.depth}
+			before := verdictMix{hard: 3, decided: 3}
+			after := before
+			after.numHard, after.numDecided = test.numHard, test.numDecided
+			changed := e.update(before, after, test.roundsLeft)
+			if changed != test.changed {
+				t.Errorf("changed %v, expected %v", changed, test.changed)
+			}
+			if e.budget != test.expectedBudget || e.depth != test.expectedDepth {
+				t.Errorf("budget %d and depth %d, expected %d and %d", e.budget, e.depth, test.expectedBudget, test.expectedDepth)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+)
+
+// an examination of the MCC for which formulas can be generated
+type examination struct {
+	name             string
+	generation       func(int, modelInfo) (formula, error)
+	xmlFileName      string
+	hrFileName       string
+	verdictsFileName string
+	metadataFileName string
+	formulaType      string // used in the ids of the formulas
+}
+
+// all the examinations that Citili can generate, in generation order
+var examinations []examination = []examination{
+	{"CTLFireability", genCTLFireabilityFormula, "CTLFireability.xml", "CTLFireability.txt", "CTLFireability.verdicts", "CTLFireability.json", "CTLFireability"},
+	{"CTLCardinality", genCTLCardinalityFormula, "CTLCardinality.xml", "CTLCardinality.txt", "CTLCardinality.verdicts", "CTLCardinality.json", "CTLCardinality"},
+	{"ReachabilityFireability", genReachabilityFireabilityFormula, "ReachabilityFireability.xml", "ReachabilityFireability.txt", "ReachabilityFireability.verdicts", "ReachabilityFireability.json", "ReachabilityFireability"},
+	{"ReachabilityCardinality", genReachabilityCardinalityFormula, "ReachabilityCardinality.xml", "ReachabilityCardinality.txt", "ReachabilityCardinality.verdicts", "ReachabilityCardinality.json", "ReachabilityCardinality"},
+	{"LTLFireability", genLTLFireabilityFormula, "LTLFireability.xml", "LTLFireability.txt", "LTLFireability.verdicts", "LTLFireability.json", "LTLFireability"},
+	{"LTLCardinality", genLTLCardinalityFormula, "LTLCardinality.xml", "LTLCardinality.txt", "LTLCardinality.verdicts", "LTLCardinality.json", "LTLCardinality"},
+	{"UpperBounds", genUpperBoundsFormula, "UpperBounds.xml", "UpperBounds.txt", "UpperBounds.verdicts", "UpperBounds.json", "UpperBounds"},
+}
+
+// examinations listed in the configuration (all of them if none is listed)
+func selectedExaminations() []examination {
+	if len(globalConfiguration.Examinations) == 0 {
+		return examinations
+	}
+
+	selected := make([]examination, 0, len(globalConfiguration.Examinations))
+	for _, name := range globalConfiguration.Examinations {
+		found := false
+		for _, e := range examinations {
+			if e.name == name {
+				selected = append(selected, e)
+				found = true
+				break
+			}
+		}
+		if !found {
+			log.Fatal("Unknown examination ", name, ", available examinations are: ", examinationNames(examinations))
+		}
+	}
+	return selected
+}
+
+// random generator for the formulas of an examination on a model, it depends
+// only on the seed and on the names of the model and of the examination, so
+// that the formulas of an examination do not depend on the other selected
+// examinations
+func (e examination) rand(m *modelInfo) *rand.Rand {
+	return newModelRand(globalConfiguration.Seed, m.name()+"/"+e.name)
+}
+
+func examinationNames(exams []examination) string {
+	names := make([]string, len(exams))
+	for i, e := range exams {
+		names[i] = e.name
+	}
+	return strings.Join(names, ", ")
+}
@@ -1,161 +1,172 @@
 package main
 
-import (
-	"bufio"
-	"fmt"
-	"io"
-	"log"
-	"os/exec"
-	"strconv"
-	"strings"
+import "log"
+
+// status of a formula after filtering
+type filterStatus int
+
+const (
+	skipped filterStatus = iota // not checked (the checker stopped early or failed)
+	trivial                     // decided on the initial marking
+	decided                     // decided by the model checker
+	hard                        // not decided by the model checker
 )
 
-func (m *modelInfo) filter(formulas []formula, numToFind int, canUnfold bool, logger *log.Logger, routineNum int) []int {
+func (s filterStatus) String() string {
+	switch s {
+	case trivial:
+		return "trivial"
+	case decided:
+		return "decided"
+	case hard:
+		return "hard"
+	}
+	return "skipped"
+}
+
+// outcome of the filtering of a formula
+type filterResult struct {
+	status     filterStatus
+	verdict    verdict // for trivial and decided formulas
+	bound      int     // for place-bound formulas with boundVerdict
+	states     int     // number of states explored, -1 if not known
+	technique  string  // how the verdict was obtained, empty if not checked
+	difficulty difficulty
+}
+
+// filter formulas, giving the verdict of each of them: formulas decided on the
+// initial marking are trivial, the other ones are model checked within a
+// budget of maxStates states, an error is returned if the model checker could
+// not be run, the difficulty of each formula is also given
+func (m *modelInfo) filter(formulas []formula, numToFind, maxStates int, canUnfold bool, logger *log.Logger, job string) ([]filterResult, error) {
+
+	results := make([]filterResult, len(formulas))
+	for i := range results {
+		results[i] = filterResult{status: skipped, verdict: unknownVerdict, states: -1}
+	}
 
 	// model
 	modelPath := m.filePath
+	generated := formulas
 
 	// formulas
 	if m.modelType == col {
-		// if colored with no twin we can do nothing, just keep the formulas
-		if m.twinModel == nil {
-			logger.Print("COL model without PT equivalent, cannot filter formulas")
-			res := make([]int, len(formulas))
-			for i := 0; i < len(formulas); i++ {
-				res[i] = i
-			}
-			return res
-		}
-		// if colored with twin but no correct mapping to PT
+		// if colored but no correct mapping to PT (from the twin or from the native unfolding)
+		// we can do nothing, the formulas are not checked and their difficulty is not known
 		if !canUnfold {
-			logger.Print("COL model with PT equivalent but that cannot be unfold (impossible mapping), cannot filter formulas")
-			res := make([]int, len(formulas))
-			for i := 0; i < len(formulas); i++ {
-				res[i] = i
-			}
-			return res
+			logger.Print("COL model that cannot be unfold (impossible mapping or unsupported colors), cannot filter formulas")
+			setDifficulties(generated, results, maxStates)
+			return results, nil
 		}
-		// if colored and has twin, unfold for using SMC
+		// if colored, unfold for using the model checker
 		unfoldedFormulas := make([]formula, len(formulas))
 		for i := 0; i < len(formulas); i++ {
-			unfoldedFormulas[i] = m.twinModel.unfolding(formulas[i])
+			unfoldedFormulas[i] = m.unfoldingModel().unfolding(formulas[i])
 		}
 		formulas = unfoldedFormulas
 		// change the model accordingly
-		modelPath = m.twinModel.filePath
+		if m.twinModel != nil {
+			modelPath = m.twinModel.filePath
+		}
 	}
 
-	tmpFileName := fmt.Sprint(globalConfiguration.SMCTmpFileName, routineNum, ".xml")
-	m.writexmlFormulas(formulas, tmpFileName, "ForFiltering", false, logger)
-
-	// smc run
-	logger.Print("running SMC on model ", modelPath, " with formulas file ", tmpFileName)
-
-	return runSMC(modelPath, tmpFileName, numToFind, logger, routineNum, m.modelInstanceSeparators)
-}
-
-func runSMC(model, formulas string, numToFind int, logger *log.Logger, routineNum int, numSeparators int) []int {
-	tokeep := make([]int, 0)
-	smcMaxStates := fmt.Sprint("--max-states=", globalConfiguration.SMCMaxStates)
-	smcStopAfter := fmt.Sprint("--mcc15-stop-after=", numToFind)
-	smcCommand := exec.Command("python", globalConfiguration.SMCPath, "--use10", smcMaxStates, smcStopAfter, model, formulas)
-	logFile := fmt.Sprint(globalConfiguration.SMClogfile, routineNum)
-	logSMCCommand := exec.Command("tee", "-a", logFile)
-	filterCommand1 := exec.Command("grep", "-v", "^smc:")
-	filterCommand2 := exec.Command("grep", "?")
-	fieldFilter := fmt.Sprint("-f", 7+numSeparators)
-	cutCommand := exec.Command("cut", "-d-", fieldFilter)
-	logReader, smcWriter := io.Pipe()
-	command1Reader, logWriter := io.Pipe()
-	command2Reader, command1Writer := io.Pipe()
-	cutCommandReader, command2Writer := io.Pipe()
-	smcCommand.Stdout = smcWriter
-	logSMCCommand.Stdin = logReader
-	logSMCCommand.Stdout = logWriter
-	filterCommand1.Stdin = command1Reader
-	filterCommand1.Stdout = command1Writer
-	filterCommand2.Stdin = command2Reader
-	filterCommand2.Stdout = command2Writer
-	cutCommand.Stdin = cutCommandReader
-	stdout, err := cutCommand.StdoutPipe()
+	// formulas decided by the initial marking are easy, no need to model check them
+	undecided := make([]int, 0, len(formulas))
+	undecidedFormulas := make([]formula, 0, len(formulas))
+	net, err := m.ptNet()
 	if err != nil {
-		logger.Print("ERROR: filter, StdoutPipe(): ", err)
-		return tokeep
-	}
-	smcCommandOutput := bufio.NewReader(stdout)
-	stderr, err := smcCommand.StderrPipe()
-	if err != nil {
-		logger.Print("ERROR: filter, StderrPipe(): ", err)
-		return tokeep
-	}
-	smcCommandError := bufio.NewReader(stderr)
-	if err := smcCommand.Start(); err != nil {
-		logger.Print("ERROR: filter, start SMC: ", err)
-		return tokeep
-	}
-	if err := logSMCCommand.Start(); err != nil {
-		logger.Print("ERROR: filter, start tee: ", err)
-		return tokeep
-	}
-	if err := filterCommand1.Start(); err != nil {
-		logger.Print("ERROR: filter, start grep 1: ", err)
-		return tokeep
-	}
-	if err := filterCommand2.Start(); err != nil {
-		logger.Print("ERROR: filter, start grep 2: ", err)
-		return tokeep
-	}
-	if err := cutCommand.Start(); err != nil {
-		logger.Print("ERROR: filter, start cut: ", err)
-		return tokeep
-	}
-	res, err := smcCommandError.ReadString('\n')
-	for ; err == nil; res, err = smcCommandError.ReadString('\n') {
-		logger.Print("SMC ERROR: ", res)
-	}
-	if err != io.EOF {
-		logger.Print("ERROR: filter, stderr reading error: ", err)
-		return tokeep
+		logger.Print("Warning: cannot evaluate formulas on the initial marking: ", err)
+	}
+	for i, f := range formulas {
+		if net != nil {
+			if v := net.evalInitial(f); v != unknownVerdict {
+				results[i].status = trivial
+				results[i].verdict = v
+				results[i].technique = "INITIAL_MARKING"
+				if v == boundVerdict {
+					results[i].bound, _ = net.initialBound(f)
+				}
+				continue
+			}
+		}
+		undecided = append(undecided, i)
+		undecidedFormulas = append(undecidedFormulas, f)
 	}
-	if err := smcCommand.Wait(); err != nil {
-		logger.Print("ERROR: filter, wait SMC: ", err)
-		return tokeep
+	logger.Print("Initial marking decides ", len(formulas)-len(undecided), " formulas")
+
+	checked, err := m.check(undecidedFormulas, modelPath, net, numToFind, maxStates, logger, job)
+	unchecked := 0
+	for _, r := range checked {
+		if r.index >= len(undecided) {
+			continue
+		}
+		res := &results[undecided[r.index]]
+		res.states = r.states
+		res.technique = r.technique
+		switch {
+		case r.err != nil:
+			// not checked, neither hard nor decided
+			if unchecked == 0 {
+				logger.Print("Warning: formula not checked: ", r.err)
+			}
+			unchecked++
+			res.status = skipped
+			res.technique = ""
+		case r.timedOut && globalConfiguration.TimeoutPolicy != "hard":
+			res.status = skipped
+		case r.verdict == unknownVerdict:
+			res.status = hard
+		default:
+			res.status = decided
+			res.verdict = r.verdict
+			res.bound = r.bound
+			// a bound that is the initial marking is as easy as the
+			// ones decided on the initial marking
+			if r.verdict == boundVerdict && net != nil {
+				if tokens, known := net.initialTokens(formulas[undecided[r.index]]); known && tokens == r.bound {
+					res.status = trivial
+				}
+			}
+		}
 	}
-	smcWriter.Close()
-	if err := logSMCCommand.Wait(); err != nil {
-		logger.Print("ERROR: filter, wait tee: ", err)
-		return tokeep
+	if unchecked > 0 {
+		logger.Print(unchecked, " formulas could not be checked by the model checker")
 	}
-	logReader.Close()
-	logWriter.Close()
-	if err := filterCommand1.Wait(); err != nil {
-		logger.Print("WARNING: problem during grep while filtering formulas: ", err)
+	setDifficulties(generated, results, maxStates)
+	return results, err
+}
+
+// model check (PT or unfolded) formulas with the configured checker
+func (m *modelInfo) check(formulas []formula, modelPath string, net *petriNet, numToFind, maxStates int, logger *log.Logger, job string) ([]checkerResult, error) {
+
+	checker, err := newChecker(maxStates)
+	if err != nil {
+		return nil, err
 	}
-	command1Reader.Close()
-	command1Writer.Close()
-	if err := filterCommand2.Wait(); err != nil {
-		logger.Print("WARNING: problem during grep while filtering formulas (probably, no difficult formula was found): ", err)
+	// the native unfolding of a COL model only exists in memory, external
+	// model checkers cannot be used on it
+	if m.unfoldedNet != nil {
+		checker = nativeChecker{maxStates: maxStates}
 	}
-	command2Reader.Close()
-	command2Writer.Close()
-	res, err = smcCommandOutput.ReadString('\n')
-	for ; err == nil; res, err = smcCommandOutput.ReadString('\n') {
-		//log.Print("SMC :", res)
-		v, err := strconv.Atoi(strings.TrimSuffix(res, "\n"))
-		if err != nil {
-			logger.Print("ERROR: filter, atoi: ", err)
-		} else {
-			tokeep = append(tokeep, v)
+
+	logger.Print("running ", checker.name(), " model checker on model ", modelPath)
+	return checker.check(checkRequest{
+		model:     m,
+		modelPath: modelPath,
+		net:       net,
+		formulas:  formulas,
+		numToFind: numToFind,
+		job:       job,
+	}, logger)
+}
+
+// indices of the formulas that are hard, according to their filtering
+func hardFormulas(results []filterResult) []int {
+	indices := make([]int, 0)
+	for i, r := range results {
+		if r.status == hard {
+			indices = append(indices, i)
 		}
 	}
-	if err != io.EOF {
-		logger.Print("ERROR: filter, stdout reading error: ", err)
-		return tokeep
-	}
-	if err := cutCommand.Wait(); err != nil {
-		logger.Print("ERROR: filter, wait cut: ", err)
-		return tokeep
-	}
-	cutCommandReader.Close()
-	return tokeep
+	return indices
 }
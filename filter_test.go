@@ -0,0 +1,114 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"io"
+	"log"
+	"testing"
+)
+
+// p0 is only emptied (into p1), and p2 and p3 exchange one token
+func boundsNet() *petriNet {
+	return newTestNet(
+		[]string{"p0", "p1", "p2", "p3"}, []int{2, 0, 1, 0},
+		testTransition{"t0", map[string]int{"p0": 1}, map[string]int{"p1": 1}},
+		testTransition{"t1", map[string]int{"p2": 1}, map[string]int{"p3": 1}},
+		testTransition{"t2", map[string]int{"p3": 1}, map[string]int{"p2": 1}},
+	)
+}
+
+func placeBound(places ...string) formula {
+	return formula{operator: placebound, operand: nodes(places...)}
+}
+
+// place-bound formulas whose bound is the initial marking are trivial,
+// whether it is known from the structure of the net or by the model checker
+func TestFilterUpperBounds(t *testing.T) {
+	setTestConfig(t, nil)
+	tests := []struct {
+		formula   formula
+		status    filterStatus
+		bound     int
+		technique string
+	}{
+		{placeBound("p0"), trivial, 2, "INITIAL_MARKING"},
+		{placeBound("p1"), decided, 2, "EXPLICIT"},
+		{placeBound("p2"), trivial, 1, "EXPLICIT"},
+		{placeBound("p3"), decided, 1, "EXPLICIT"},
+		{placeBound("p0", "p1"), trivial, 2, "INITIAL_MARKING"},
+		{placeBound("p2", "p3"), trivial, 1, "INITIAL_MARKING"},
+	}
+	formulas := make([]formula, len(tests))
+	for i, test := range tests {
+		formulas[i] = test.formula
+	}
+	m := &modelInfo{modelType: pt, net: boundsNet()}
+	results, err := m.filter(formulas, len(formulas), 100, true, log.New(io.Discard, "", 0), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, test := range tests {
+		r := results[i]
+		if r.status != test.status || r.verdict != boundVerdict || r.bound != test.bound || r.technique != test.technique {
+			t.Errorf("%s: %v %v %d %s, expected %v %v %d %s", test.formula.ashr(),
+				r.status, r.verdict, r.bound, r.technique, test.status, boundVerdict, test.bound, test.technique)
+		}
+	}
+}
+
+// the places of a COL model are unfolded before filtering, a COL place is
+// dropped if the places it is unfolded to are
+func TestFilterUnfoldedUpperBounds(t *testing.T) {
+	setTestConfig(t, nil)
+	m := &modelInfo{
+		modelType:     col,
+		unfoldedNet:   boundsNet(),
+		placesMapping: map[string][]string{"a": {"p0"}, "b": {"p1"}, "c": {"p2", "p3"}},
+	}
+	if got := m.unfolding(placeBound("c", "a")).ashr(); got != `place-bound("p2", "p3", "p0")` {
+		t.Errorf("place-bound(c, a) unfolded to %s", got)
+	}
+	results, err := m.filter([]formula{placeBound("a"), placeBound("b"), placeBound("c")}, 3, 100, true, log.New(io.Discard, "", 0), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range []filterStatus{trivial, decided, trivial} {
+		if results[i].status != status {
+			t.Errorf("formula %d: %v, expected %v", i, results[i].status, status)
+		}
+	}
+}
+
+// the formulas of a COL model that cannot be unfolded are not checked
+func TestFilterCannotUnfold(t *testing.T) {
+	setTestConfig(t, nil)
+	m := &modelInfo{modelName: "Toy", modelType: col, modelInstance: "001"}
+	results, err := m.filter([]formula{modal(existsPathOperator, finallyOperator, fireable("t0"))}, 1, 100, false, log.New(io.Discard, "", 0), "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := results[0]
+	if r.status != skipped || r.verdict != unknownVerdict || r.technique != "" {
+		t.Errorf("formula %v %v (%s), expected not checked", r.status, r.verdict, r.technique)
+	}
+	if r.difficulty.states != -1 || r.difficulty.score != -1 {
+		t.Errorf("difficulty %+v, expected an unknown one", r.difficulty)
+	}
+}
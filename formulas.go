@@ -20,34 +20,100 @@ package main
 import (
 	"fmt"
 	"math/rand"
+	"sort"
 )
 
+// number of formulas drawn when looking for one with some properties,
+// before giving up
+const maxGenerationTries int = 1000
+
 type formula struct {
 	operator operator
 	operand  []formula
 }
 
+// Checks if two formulas are syntactically equal
+func (f formula) equals(g formula) bool {
+	if f.operator.name != g.operator.name || len(f.operand) != len(g.operand) {
+		return false
+	}
+	for i := range f.operand {
+		if !f.operand[i].equals(g.operand[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Canonical form of a formula, for detecting duplicates: operands of
+// commutative operators are sorted, and so are the places or transitions
+// of atoms (without repetitions)
+func (f formula) canonical() formula {
+	switch f.operator.name {
+	case "is-fireable", "tokens-count", "place-bound":
+		nodes := make([]formula, 0, len(f.operand))
+		seen := make(map[string]bool)
+		for _, n := range f.operand {
+			if !seen[n.operator.name] {
+				seen[n.operator.name] = true
+				nodes = append(nodes, n)
+			}
+		}
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].operator.name < nodes[j].operator.name })
+		return formula{operator: f.operator, operand: nodes}
+	case "integer-constant":
+		return f
+	}
+
+	g := formula{operator: f.operator, operand: make([]formula, len(f.operand))}
+	for i, operand := range f.operand {
+		g.operand[i] = operand.canonical()
+	}
+	if f.operator.name == "and" || f.operator.name == "or" {
+		keys := make(map[int]string)
+		for i, operand := range g.operand {
+			keys[i] = operand.ashr()
+		}
+		indices := make([]int, len(g.operand))
+		for i := range indices {
+			indices[i] = i
+		}
+		sort.SliceStable(indices, func(i, j int) bool { return keys[indices[i]] < keys[indices[j]] })
+		sorted := make([]formula, len(g.operand))
+		for i, k := range indices {
+			sorted[i] = g.operand[k]
+		}
+		g.operand = sorted
+	}
+	return g
+}
+
+// A key identifying a formula up to its canonical form
+func (f formula) key() string {
+	return f.canonical().ashr()
+}
+
 // Generation of a boolean formula
-func genBooleanFormula(maxDepth int) (f formula) {
+func genBooleanFormula(maxDepth int, r *rand.Rand) (f formula) {
 	if maxDepth <= 1 {
 		f = formula{operator: booleanOperators[0]}
 		return f
 	}
 
 	// choose operator
-	opNum := rand.Intn(len(booleanOperators))
+	opNum := r.Intn(len(booleanOperators))
 	f = formula{operator: booleanOperators[opNum]}
 
 	// generate subformulas
-	arity := rand.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
+	arity := r.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
 	f.operand = make([]formula, arity)
 	if f.operator.isOverBooleans {
 		for i := 0; i < arity; i++ {
-			f.operand[i] = genBooleanFormula(maxDepth - 1)
+			f.operand[i] = genBooleanFormula(maxDepth-1, r)
 		}
 	} else {
 		for i := 0; i < arity; i++ {
-			f.operand[i] = genPathFormula(maxDepth - 1)
+			f.operand[i] = genPathFormula(maxDepth-1, r)
 		}
 	}
 
@@ -55,62 +121,142 @@ func genBooleanFormula(maxDepth int) (f formula) {
 }
 
 // Generation of a path formula
-func genPathFormula(maxDepth int) (f formula) {
+func genPathFormula(maxDepth int, r *rand.Rand) (f formula) {
 	// choose operator
-	opNum := rand.Intn(len(pathOperators))
+	opNum := r.Intn(len(pathOperators))
 	f = formula{operator: pathOperators[opNum]}
 
 	// generate subformulas
-	arity := rand.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
+	arity := r.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
 	f.operand = make([]formula, arity)
 	for i := 0; i < arity; i++ {
-		f.operand[i] = genBooleanFormula(maxDepth - 1)
+		f.operand[i] = genBooleanFormula(maxDepth-1, r)
 	}
 
 	return f
 }
 
 // Generation of a generic CTL formula
-func genCTLFormula(maxDepth int) formula {
-	f := genBooleanFormula(maxDepth)
-	for isInOtherCategory(f) || !isInteresting(f) {
-		f = genBooleanFormula(maxDepth)
+func genCTLFormula(maxDepth int, r *rand.Rand) (formula, error) {
+	for i := 0; i < maxGenerationTries; i++ {
+		f := genBooleanFormula(maxDepth, r)
+		if !isInOtherCategory(f) && isInteresting(f) {
+			return f, nil
+		}
 	}
-	return removeDoubleNegations(f)
+	return formula{}, fmt.Errorf("no interesting CTL formula of depth %d found in %d tries", maxDepth, maxGenerationTries)
 }
 
 // Generation of a state formula
-func genStateFormula(maxDepth int) (f formula) {
+func genStateFormula(maxDepth int, r *rand.Rand) (f formula) {
 	if maxDepth <= 1 {
 		f = formula{operator: stateOperators[0]}
 		return f
 	}
 
 	// choose operator
-	opNum := rand.Intn(len(stateOperators))
+	opNum := r.Intn(len(stateOperators))
 	f = formula{operator: stateOperators[opNum]}
 
 	// generate subformulas
-	arity := rand.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
+	arity := r.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
 	f.operand = make([]formula, arity)
 	for i := 0; i < arity; i++ {
-		f.operand[i] = genStateFormula(maxDepth - 1)
+		f.operand[i] = genStateFormula(maxDepth-1, r)
 	}
 
 	return f
 }
 
 // Generation of a generic reachability formula
-func genReachabilityFormula(maxDepth int) (f formula) {
-	if rand.Intn(2) == 0 {
+func genReachabilityFormula(maxDepth int, r *rand.Rand) (f formula) {
+	if r.Intn(2) == 0 {
 		f.operator = allPathsOperator
 		f.operand = []formula{{operator: globallyOperator}}
 	} else {
 		f.operator = existsPathOperator
 		f.operand = []formula{{operator: finallyOperator}}
 	}
-	f.operand[0].operand = []formula{genStateFormula(maxDepth)}
-	return removeDoubleNegations(f)
+	f.operand[0].operand = []formula{genStateFormula(maxDepth, r)}
+	return f
+}
+
+// Generation of an LTL path formula (no path quantifier)
+func genLTLPathFormula(maxDepth int, r *rand.Rand) (f formula) {
+	if maxDepth <= 1 {
+		f = formula{operator: ltlOperators[0]}
+		return f
+	}
+
+	// choose operator
+	opNum := r.Intn(len(ltlOperators))
+	f = formula{operator: ltlOperators[opNum]}
+
+	// generate subformulas
+	arity := r.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
+	f.operand = make([]formula, arity)
+	for i := 0; i < arity; i++ {
+		f.operand[i] = genLTLPathFormula(maxDepth-1, r)
+	}
+
+	return f
+}
+
+// Generation of an LTL path formula starting with a temporal operator
+func genLTLTemporalFormula(maxDepth int, r *rand.Rand) (f formula) {
+	temporalOperators := []operator{globallyOperator, finallyOperator, nextOperator, untilOperator}
+	f = formula{operator: temporalOperators[r.Intn(len(temporalOperators))]}
+
+	// generate subformulas
+	arity := r.Intn(f.operator.maxArity+1-f.operator.minArity) + f.operator.minArity
+	f.operand = make([]formula, arity)
+	for i := 0; i < arity; i++ {
+		f.operand[i] = genLTLPathFormula(maxDepth-1, r)
+	}
+
+	return f
+}
+
+// Generation of a generic LTL formula, an error is returned if no
+// interesting formula is found within maxGenerationTries tries
+func genLTLFormula(maxDepth int, r *rand.Rand) (f formula, err error) {
+	f.operator = allPathsOperator
+	for tries := 0; tries < maxGenerationTries; tries++ {
+		f.operand = []formula{genLTLTemporalFormula(maxDepth-1, r)}
+		if isInterestingLTL(f) {
+			return f, nil
+		}
+	}
+	return f, fmt.Errorf("no interesting LTL formula of depth %d found in %d tries", maxDepth, maxGenerationTries)
+}
+
+// Checks if an LTL formula is of interest:
+// it uses at least one temporal operator and it is not
+// a reachability formula (A G xxx with no temporal operator in xxx)
+func isInterestingLTL(f formula) bool {
+	path := f.operand[0]
+	if !containsTemporalOperator(path) {
+		return false
+	}
+	if path.operator == globallyOperator {
+		return containsTemporalOperator(path.operand[0])
+	}
+	return true
+}
+
+// Checks if a formula contains a temporal operator
+func containsTemporalOperator(f formula) bool {
+	for _, op := range pathOperators {
+		if f.operator == op {
+			return true
+		}
+	}
+	for _, operand := range f.operand {
+		if containsTemporalOperator(operand) {
+			return true
+		}
+	}
+	return false
 }
 
 // Checks if a CTL formula also belongs to another category
@@ -153,50 +299,85 @@ func isInteresting(f formula) bool {
 			}
 		}
 	}
-	return f.operator != atom
+	return !isStateAtom(f)
+}
+
+// Checks if a formula is an atom (or a placeholder for an atom)
+func isStateAtom(f formula) bool {
+	return f.operator == atom || f.operator.name == "is-fireable" || f.operator.name == "leq"
 }
 
-// Remove not not from a formula
-func removeDoubleNegations(f formula) formula {
-	if f.operator.name == "not" {
-		if f.operand[0].operator.name == "not" {
-			return removeDoubleNegations(f.operand[0])
+// Generation of formulas until one is still valid once simplified
+// (simplification may make a formula trivial or change its category),
+// giving up after maxGenerationTries formulas
+func genSimplified(gen func() (formula, error), isValid func(formula) bool) (formula, error) {
+	for i := 0; i < maxGenerationTries; i++ {
+		f, err := gen()
+		if err != nil {
+			return f, err
 		}
-	}
-	if f.operator != atom {
-		for i, operand := range f.operand {
-			f.operand[i] = removeDoubleNegations(operand)
+		f = simplify(f)
+		if !containsConstant(f) && isValid(f) {
+			return f, nil
 		}
 	}
-	return f
+	return formula{}, fmt.Errorf("no formula still valid once simplified found in %d tries", maxGenerationTries)
+}
+
+// Checks if a formula is a CTL formula belonging to no other category
+func isCTLFormula(f formula) bool {
+	return !isInOtherCategory(f) && isInteresting(f)
+}
+
+// Checks if a formula is a reachability formula: EF xxx or AG xxx with
+// no temporal operator in xxx
+func isReachabilityFormula(f formula) bool {
+	if f.operator.name != "A" && f.operator.name != "E" {
+		return false
+	}
+	if f.operand[0].operator.name != "G" && f.operand[0].operator.name != "F" {
+		return false
+	}
+	state := f.operand[0].operand[0]
+	return !containsCTLOperator(state) && !containsTemporalOperator(state)
+}
+
+// Checks if a formula is an interesting LTL formula: A xxx with no A or E in xxx
+func isLTLFormula(f formula) bool {
+	return f.operator.name == "A" && !containsCTLOperator(f.operand[0]) && isInterestingLTL(f)
 }
 
 // Generation of a CTLFireability formula
-func genCTLFireabilityFormula(maxDepth int, m modelInfo) (f formula) {
-	f = genCTLFormula(maxDepth)
-	f.fireabilitySubstituteAtoms(m.transitions)
-	return f
+func genCTLFireabilityFormula(maxDepth int, m modelInfo) (formula, error) {
+	return genSimplified(func() (formula, error) {
+		f, err := genCTLFormula(maxDepth, m.rng)
+		if err != nil {
+			return f, err
+		}
+		f.fireabilitySubstituteAtoms(m.transitions, m.rng)
+		return f, nil
+	}, isCTLFormula)
 }
 
-func (f *formula) fireabilitySubstituteAtoms(transitions []string) {
+func (f *formula) fireabilitySubstituteAtoms(transitions []string, r *rand.Rand) {
 	if f.operator == atom {
-		*f = genFireabilityAtom(transitions)
+		*f = genFireabilityAtom(transitions, r)
 		return
 	}
 	for opNum := 0; opNum < len(f.operand); opNum++ {
-		f.operand[opNum].fireabilitySubstituteAtoms(transitions)
+		f.operand[opNum].fireabilitySubstituteAtoms(transitions, r)
 	}
 }
 
-func genFireabilityAtom(transitions []string) (f formula) {
+func genFireabilityAtom(transitions []string, r *rand.Rand) (f formula) {
 	f = formula{operator: isfireable}
 	f.operand = make([]formula, 0)
 	maxTransitions := len(transitions)
 	if maxTransitions > globalConfiguration.MaxFireabilityAtomSize {
 		maxTransitions = globalConfiguration.MaxFireabilityAtomSize
 	}
-	numTransitions := rand.Intn(maxTransitions) + 1
-	rand.Shuffle(len(transitions), func(i, j int) { transitions[i], transitions[j] = transitions[j], transitions[i] })
+	numTransitions := r.Intn(maxTransitions) + 1
+	r.Shuffle(len(transitions), func(i, j int) { transitions[i], transitions[j] = transitions[j], transitions[i] })
 	for i := 0; i < numTransitions; i++ {
 		ff := formula{operator: operator{name: transitions[i]}}
 		f.operand = append(f.operand, ff)
@@ -205,10 +386,15 @@ func genFireabilityAtom(transitions []string) (f formula) {
 }
 
 // Generation of a CTLCardinality formula
-func genCTLCardinalityFormula(maxDepth int, m modelInfo) (f formula) {
-	f = genCTLFormula(maxDepth)
-	f.cardinalitySubstituteAtoms(m)
-	return f
+func genCTLCardinalityFormula(maxDepth int, m modelInfo) (formula, error) {
+	return genSimplified(func() (formula, error) {
+		f, err := genCTLFormula(maxDepth, m.rng)
+		if err != nil {
+			return f, err
+		}
+		f.cardinalitySubstituteAtoms(m)
+		return f, nil
+	}, isCTLFormula)
 }
 
 func (f *formula) cardinalitySubstituteAtoms(m modelInfo) {
@@ -224,45 +410,80 @@ func (f *formula) cardinalitySubstituteAtoms(m modelInfo) {
 func genCardinalityAtom(m modelInfo) (f formula) {
 	f = formula{operator: leqOperator}
 	f.operand = make([]formula, 2)
-	tokencountChoice := rand.Intn(3) // 0 : tokencount on the left, 1: tokencount on the right, 2: tokencount on both sides
+	tokencountChoice := m.rng.Intn(3) // 0 : tokencount on the left, 1: tokencount on the right, 2: tokencount on both sides
 	switch tokencountChoice {
 	case 0:
-		f.operand[0] = genTokencount(m.places)
-		f.operand[1] = genIntconstant(0, m.maxConstantInMarking)
+		f.operand[0] = genTokencount(m.places, m.rng)
+		f.operand[1] = genIntconstant(0, m.maxConstantInMarking, m.rng)
 	case 1:
-		f.operand[0] = genIntconstant(1, m.maxConstantInMarking)
-		f.operand[1] = genTokencount(m.places)
+		f.operand[0] = genIntconstant(1, m.maxConstantInMarking, m.rng)
+		f.operand[1] = genTokencount(m.places, m.rng)
 	case 2:
-		f.operand[0] = genTokencount(m.places)
-		f.operand[1] = genTokencount(m.places)
+		f.operand[0] = genTokencount(m.places, m.rng)
+		f.operand[1] = genTokencount(m.places, m.rng)
 	}
 	return f
 }
 
 // Generation of a ReachabilityFireability formula
-func genReachabilityFireabilityFormula(maxDepth int, m modelInfo) (f formula) {
-	f = genReachabilityFormula(maxDepth)
-	f.fireabilitySubstituteAtoms(m.transitions)
-	return f
+func genReachabilityFireabilityFormula(maxDepth int, m modelInfo) (formula, error) {
+	return genSimplified(func() (formula, error) {
+		f := genReachabilityFormula(maxDepth, m.rng)
+		f.fireabilitySubstituteAtoms(m.transitions, m.rng)
+		return f, nil
+	}, isReachabilityFormula)
 }
 
 // Generation of a ReachabilityCardinality formula
-func genReachabilityCardinalityFormula(maxDepth int, m modelInfo) (f formula) {
-	f = genReachabilityFormula(maxDepth)
-	f.cardinalitySubstituteAtoms(m)
-	return f
+func genReachabilityCardinalityFormula(maxDepth int, m modelInfo) (formula, error) {
+	return genSimplified(func() (formula, error) {
+		f := genReachabilityFormula(maxDepth, m.rng)
+		f.cardinalitySubstituteAtoms(m)
+		return f, nil
+	}, isReachabilityFormula)
+}
+
+// Generation of a LTLFireability formula
+func genLTLFireabilityFormula(maxDepth int, m modelInfo) (formula, error) {
+	return genSimplified(func() (formula, error) {
+		f, err := genLTLFormula(maxDepth, m.rng)
+		if err != nil {
+			return f, err
+		}
+		f.fireabilitySubstituteAtoms(m.transitions, m.rng)
+		return f, nil
+	}, isLTLFormula)
+}
+
+// Generation of a LTLCardinality formula
+func genLTLCardinalityFormula(maxDepth int, m modelInfo) (formula, error) {
+	return genSimplified(func() (formula, error) {
+		f, err := genLTLFormula(maxDepth, m.rng)
+		if err != nil {
+			return f, err
+		}
+		f.cardinalitySubstituteAtoms(m)
+		return f, nil
+	}, isLTLFormula)
+}
+
+// Generation of an UpperBounds formula
+func genUpperBoundsFormula(maxDepth int, m modelInfo) (f formula, err error) {
+	f = genTokencount(m.places, m.rng)
+	f.operator = placebound
+	return f, nil
 }
 
 // Atoms generation
-func genTokencount(places []string) (f formula) {
+func genTokencount(places []string, r *rand.Rand) (f formula) {
 	f = formula{operator: tokencount}
 	f.operand = make([]formula, 0)
 	maxPlaces := len(places)
 	if maxPlaces > globalConfiguration.MaxCardinalityAtomSize {
 		maxPlaces = globalConfiguration.MaxCardinalityAtomSize
 	}
-	numPlaces := rand.Intn(maxPlaces) + 1
-	rand.Shuffle(len(places), func(i, j int) { places[i], places[j] = places[j], places[i] })
+	numPlaces := r.Intn(maxPlaces) + 1
+	r.Shuffle(len(places), func(i, j int) { places[i], places[j] = places[j], places[i] })
 	for i := 0; i < numPlaces; i++ {
 		ff := formula{operator: operator{name: places[i]}}
 		f.operand = append(f.operand, ff)
@@ -270,7 +491,7 @@ func genTokencount(places []string) (f formula) {
 	return f
 }
 
-func genIntconstant(min int, max int) (f formula) {
+func genIntconstant(min int, max int, r *rand.Rand) (f formula) {
 	if max < 1 {
 		max = defaultConfiguration.MaxIntegerConstant
 	}
@@ -282,7 +503,7 @@ func genIntconstant(min int, max int) (f formula) {
 	}
 	f = formula{operator: integerconstant}
 	f.operand = make([]formula, 1)
-	val := fmt.Sprint(rand.Intn(max-min+1) + min)
+	val := fmt.Sprint(r.Intn(max-min+1) + min)
 	f.operand[0] = formula{operator: operator{name: val}}
 	return f
 }
@@ -0,0 +1,71 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "testing"
+
+func TestKey(t *testing.T) {
+	tests := []struct {
+		f, g string
+		same bool
+	}{
+		{`is-fireable("t0", "t1")`, `is-fireable("t1", "t0")`, true},
+		{`is-fireable("t0", "t1", "t0")`, `is-fireable("t1", "t0")`, true},
+		{`tokens-count("p1", "p0") <= 2`, `tokens-count("p0", "p1") <= 2`, true},
+		{`A G (is-fireable("t0") & is-fireable("t1"))`, `A G (is-fireable("t1") & is-fireable("t0"))`, true},
+		{`E F (is-fireable("t0") | (is-fireable("t2", "t1") & is-fireable("t3")))`, `E F ((is-fireable("t3") & is-fireable("t1", "t2")) | is-fireable("t0"))`, true},
+		{`place-bound("p0", "p1")`, `place-bound("p1", "p0")`, true},
+		{`tokens-count("p0") <= tokens-count("p1")`, `tokens-count("p1") <= tokens-count("p0")`, false},
+		{`A (is-fireable("t0") U is-fireable("t1"))`, `A (is-fireable("t1") U is-fireable("t0"))`, false},
+		{`A G is-fireable("t0")`, `E G is-fireable("t0")`, false},
+		{`is-fireable("t0")`, `is-fireable("t0", "t1")`, false},
+		{`1 <= tokens-count("p0")`, `2 <= tokens-count("p0")`, false},
+	}
+	for _, test := range tests {
+		f, g := mustParse(t, test.f), mustParse(t, test.g)
+		if same := f.key() == g.key(); same != test.same {
+			t.Errorf("%s and %s: same key %t, expected %t", test.f, test.g, same, test.same)
+		}
+	}
+}
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`is-fireable("t1", "t0", "t1")`, `is-fireable("t0", "t1")`},
+		{`is-fireable("t1") | is-fireable("t0")`, `(is-fireable("t0")) | (is-fireable("t1"))`},
+		{`A G (tokens-count("p1", "p0") <= 3 & is-fireable("t0"))`, `A (G ((is-fireable("t0")) & (tokens-count("p0", "p1") <= 3)))`},
+		{`A (is-fireable("t1") U is-fireable("t0"))`, `A ((is-fireable("t1")) U (is-fireable("t0")))`},
+	}
+	for _, test := range tests {
+		f := mustParse(t, test.input)
+		before := f.ashr()
+		if got := f.canonical().ashr(); got != test.expected {
+			t.Errorf("%s canonical form %s, expected %s", test.input, got, test.expected)
+		}
+		if f.ashr() != before {
+			t.Errorf("%s changed to %s when computing its canonical form", before, f.ashr())
+		}
+		if got := f.canonical().canonical().ashr(); got != test.expected {
+			t.Errorf("canonical form of %s not stable: %s", test.input, got)
+		}
+	}
+}
@@ -19,10 +19,24 @@ along with this program.  If not, see https://www.gnu.org/licenses/.
 package main
 
 import (
+	"fmt"
 	"log"
+	"sort"
 )
 
-func (m *modelInfo) genFormulas(numFormulas, depth, numUnfold int, logger *log.Logger, routineNum int) {
+// number of formulas generated for replacing a duplicate formula when
+// completing a set of formulas with random ones
+const maxDuplicateTries int = 100
+
+// smallest depth of generated formulas: formulas of depth 1 are atoms, which
+// are not valid formulas for the temporal examinations
+const minFormulaDepth int = 2
+
+// generate formulas for all the selected examinations of a model, the
+// examinations are handled concurrently, each with its own random generator,
+// and the preparation of the model and the filtering of formulas are run by
+// the shared workers
+func (m *modelInfo) genFormulas(numFormulas, depth, numUnfold int, logger *log.Logger) {
 
 	// should never occur, to remove after test
 	if m.twinModel != nil {
@@ -32,41 +46,39 @@ func (m *modelInfo) genFormulas(numFormulas, depth, numUnfold int, logger *log.L
 		}
 	}
 
-	var error error
-	m.getpnml(logger)
-	m.getids(logger)
-	m.getMaxConstants(logger)
-	if m.twinModel != nil {
-		m.twinModel.getpnml(logger)
-		m.twinModel.getids(logger)
-		m.twinModel.getMaxConstants(logger)
-		error = m.twinModel.mapids(logger)
-	}
+	var canUnfold bool
+	workers.run(func() {
+		canUnfold = m.prepare(logger)
+		// the nets are built before the examinations share them
+		m.ptNet()
+		if m.twinModel != nil {
+			m.twinModel.ptNet()
+		}
+	})
 
-	canUnfold := true
-	if error != nil {
-		logger.Print("Warning: will not unfold formulas: impossible mapping")
-		canUnfold = false
+	jobs := make([]func(), 0)
+	for _, e := range selectedExaminations() {
+		e := e
+		em := m.forExamination(e)
+		examLogger := log.New(logger.Writer(), fmt.Sprint(logger.Prefix(), "[", e.name, "] "), logger.Flags())
+		jobs = append(jobs, func() {
+			examLogger.Print("Generating ", numFormulas, " ", e.name, " formulas")
+			em.genericGenerationAndWriting(numFormulas, depth, numUnfold, canUnfold, e, examLogger)
+		})
 	}
+	parallel(nil, jobs...)
+}
 
-	// CTLFireability
-	logger.Print("Generating ", numFormulas, " CTLFireability formulas")
-	m.genericGenerationAndWriting(numFormulas, depth, numUnfold, canUnfold, genCTLFireabilityFormula, CTLFireabilityXMLFileName, CTLFireabilityHRFileName, "CTLFireability", logger, routineNum)
-
-	// CTLCardinality
-	logger.Print("Generating ", numFormulas, " CTLCardinality formulas")
-	m.genericGenerationAndWriting(numFormulas, depth, numUnfold, canUnfold, genCTLCardinalityFormula, CTLCardinalityXMLFileName, CTLCardinalityHRFileName, "CTLCardinality", logger, routineNum)
-
-	// ReachabilityFireability
-	logger.Print("Generating ", numFormulas, " ReachabilityFireability formulas")
-	m.genericGenerationAndWriting(numFormulas, depth, numUnfold, canUnfold, genReachabilityFireabilityFormula, ReachabilityFireabilityXMLFileName, ReachabilityFireabilityHRFileName, "ReachabilityFireability", logger, routineNum)
-
-	// ReachabilityCardinality
-	logger.Print("Generating ", numFormulas, " ReachabilityCardinality formulas")
-	m.genericGenerationAndWriting(numFormulas, depth, numUnfold, canUnfold, genReachabilityCardinalityFormula, ReachabilityCardinalityXMLFileName, ReachabilityCardinalityHRFileName, "ReachabilityCardinality", logger, routineNum)
+// checks that the formulas of a COL model to unfold for its PT twin are
+// among the generated ones
+func checkNumUnfold() error {
+	if globalConfiguration.NumUnfold < 0 || globalConfiguration.NumUnfold > globalConfiguration.NumFormulas {
+		return fmt.Errorf("NumUnfold must be between 0 and NumFormulas (%d), got %d", globalConfiguration.NumFormulas, globalConfiguration.NumUnfold)
+	}
+	return nil
 }
 
-func (m *modelInfo) genericGenerationAndWriting(numFormulas, depth, numUnfold int, canUnfold bool, generation func(int, modelInfo) formula, outXMLFileName, outHRFileName string, formulaType string, logger *log.Logger, routineNum int) {
+func (m *modelInfo) genericGenerationAndWriting(numFormulas, depth, numUnfold int, canUnfold bool, e examination, logger *log.Logger) {
 
 	modelType := "COL"
 	if m.modelType != col {
@@ -75,12 +87,19 @@ func (m *modelInfo) genericGenerationAndWriting(numFormulas, depth, numUnfold in
 	logger.Print("Working on ", modelType, " model")
 
 	// gen numFormulas formulas
-	formulas := m.genericGeneration(numFormulas, depth, canUnfold, generation, logger, routineNum)
-
-	// write to file
-	logger.Print("Writting formulas")
-	m.writexmlFormulas(formulas, outXMLFileName, formulaType, true, logger)
-	m.writehrFormulas(formulas, outHRFileName, formulaType, true, logger)
+	seen := make(map[string]bool)
+	formulas, results, err := m.genericGeneration(numFormulas, depth, canUnfold, e.generation, seen, logger, m.name()+"-"+e.name)
+	if err != nil {
+		// the PT twin still gets its own formulas
+		logger.Print("ERROR: no ", e.name, " formulas for ", m.name(), ": ", err)
+	} else {
+		// write to file
+		logger.Print("Writting formulas")
+		m.writexmlFormulas(formulas, e.xmlFileName, e.formulaType, true, logger)
+		m.writehrFormulas(formulas, e.hrFileName, e.formulaType, true, logger)
+		m.writeVerdicts(results, e.verdictsFileName, e.formulaType, logger)
+		m.writeMetadata(results, e.metadataFileName, e.formulaType, logger)
+	}
 
 	if m.twinModel == nil {
 		return
@@ -94,57 +113,230 @@ func (m *modelInfo) genericGenerationAndWriting(numFormulas, depth, numUnfold in
 	if !canUnfold {
 		numUnfold = 0
 	}
+	if numUnfold > len(formulas) {
+		numUnfold = len(formulas)
+	}
 	logger.Print("Unfolding ", numUnfold, " formulas")
+	seen = make(map[string]bool)
+	unfolded := make([]formula, numUnfold, numFormulas)
+	unfoldedResults := make([]filterResult, numUnfold, numFormulas)
 	for i := 0; i < numUnfold; i++ {
-		formulas[i] = m.unfolding(formulas[i])
+		unfolded[i] = m.unfolding(formulas[i])
+		unfoldedResults[i] = results[i]
+		unfoldedResults[i].difficulty = newDifficulty(unfolded[i], results[i], results[i].difficulty.budget)
+		seen[unfolded[i].key()] = true
 	}
 
-	// generating numFormulas - numUnfold formulas
-	newFormulas := m.genericGeneration(numFormulas-numUnfold, depth, canUnfold, generation, logger, routineNum)
-	for i := numUnfold; i < numFormulas; i++ {
-		formulas[i] = newFormulas[i-numUnfold]
+	// generating numFormulas - numUnfold formulas, different from the unfolded ones
+	// (the unfolded formulas keep their verdicts, they were checked on this model)
+	newFormulas, newResults, err := m.genericGeneration(numFormulas-numUnfold, depth, canUnfold, e.generation, seen, logger, m.name()+"-"+e.name)
+	if err != nil {
+		logger.Print("ERROR: no ", e.name, " formulas for ", m.name(), ": ", err)
+		return
 	}
+	formulas = append(unfolded, newFormulas...)
+	results = append(unfoldedResults, newResults...)
 
 	// write to file
 	logger.Print("Writting formulas")
-	m.writexmlFormulas(formulas, outXMLFileName, formulaType, true, logger)
-	m.writehrFormulas(formulas, outHRFileName, formulaType, true, logger)
+	m.writexmlFormulas(formulas, e.xmlFileName, e.formulaType, true, logger)
+	m.writehrFormulas(formulas, e.hrFileName, e.formulaType, true, logger)
+	m.writeVerdicts(results, e.verdictsFileName, e.formulaType, logger)
+	m.writeMetadata(results, e.metadataFileName, e.formulaType, logger)
 }
 
-func (m *modelInfo) genericGeneration(numFormulas, depth int, canUnfold bool, generation func(int, modelInfo) formula, logger *log.Logger, routineNum int) []formula {
+// generate numFormulas formulas, none of them being a duplicate (up to their
+// canonical form) of another one or of a formula already seen, selected
+// according to their filtering to get the configured mix of verdicts, and
+// according to their difficulty with the configured selection strategy, the
+// filtering of the selected formulas is also given
+//
+// The state budget and the depth of formulas may change between filtering
+// rounds (see escalation), and if the rounds do not give enough formulas the
+// set is completed according to the configured fallback: with random formulas,
+// with filtered formulas of a smaller depth (and random formulas when the
+// smallest depth does not give enough of them), or not at all (an error is
+// then returned)
+//
+// ParallelRounds rounds are generated at once and filtered concurrently, with
+// the same state budget and depth (escalation only happens between such groups
+// of rounds), job names their files (round n has the files of job-n)
+func (m *modelInfo) genericGeneration(numFormulas, depth int, canUnfold bool, generation func(int, modelInfo) (formula, error), seen map[string]bool, logger *log.Logger, job string) ([]formula, []filterResult, error) {
 	numFound := 0
 	filterRounds := 0
+	esc := newEscalation(depth)
 	formulas := make([]formula, numFormulas)
-	for numFound < numFormulas && filterRounds < globalConfiguration.MaxFilterTries {
-		// gen numFormulas formulas
+	results := make([]filterResult, numFormulas)
+	roundsMix := newVerdictMix(numFormulas) // formulas fitting the mix, in order of generation
+	candidates := make([]candidate, 0)      // filtered formulas that could be selected
+	for roundsMix.numHard+roundsMix.numDecided < numFormulas && filterRounds < globalConfiguration.MaxFilterTries {
+		// gen the batches of the next rounds, one after the other, so that
+		// they do not depend on the order in which they are filtered
+		numRounds := globalConfiguration.ParallelRounds
+		if left := globalConfiguration.MaxFilterTries - filterRounds; numRounds > left {
+			numRounds = left
+		}
+		if numRounds < 1 {
+			numRounds = 1
+		}
 		logger.Print("Generating formulas")
-		tmpFormulas := make([]formula, globalConfiguration.FilterSetSize)
-		for i := 0; i < globalConfiguration.FilterSetSize; i++ {
-			tmpFormulas[i] = generation(depth, *m)
+		batches := make([]batch, numRounds)
+		for b := range batches {
+			batches[b].formulas = make([]formula, 0, globalConfiguration.FilterSetSize)
+			for i := 0; i < globalConfiguration.FilterSetSize; i++ {
+				f, err := generation(esc.depth, *m)
+				if err != nil {
+					return nil, nil, err
+				}
+				key := f.key()
+				if seen[key] {
+					batches[b].duplicates++
+					continue
+				}
+				seen[key] = true
+				batches[b].formulas = append(batches[b].formulas, f)
+			}
 		}
 
-		// filter out easy formula
+		// filter out easy formula, the batches are filtered concurrently by
+		// the workers
 		logger.Print("Filtering formulas")
-		toKeep := m.filter(tmpFormulas, numFormulas-numFound, canUnfold, logger, routineNum)
-		logger.Print("Filtering completed, I keep the following formulas: ", toKeep)
-		for i := 0; i < len(toKeep) && numFound < numFormulas; i++ {
-			formulas[numFound] = tmpFormulas[toKeep[i]]
-			numFound++
+		numFitting := roundsMix.numHard + roundsMix.numDecided
+		jobs := make([]func(), numRounds)
+		for b := range batches {
+			current := &batches[b]
+			batchJob := fmt.Sprint(job, "-", filterRounds+b+1)
+			budget := esc.budget
+			jobs[b] = func() {
+				current.results, current.err = m.filter(current.formulas, numFormulas-numFitting, budget, canUnfold, logger, batchJob)
+			}
 		}
+		parallel(workers, jobs...)
+
+		// handle the batches as rounds, in order
+		before := roundsMix
+		for _, current := range batches {
+			if roundsMix.numHard+roundsMix.numDecided >= numFormulas {
+				break
+			}
+			if current.err != nil {
+				logger.Print("ERROR: filter: ", current.err)
+			}
+			tmpFormulas, filtered := current.formulas, current.results
+			logger.Print("Filtering completed: ", filteringSummary(filtered))
+			numFitting := roundsMix.numHard + roundsMix.numDecided
+			kept := 0
+			for i := range filtered {
+				if filtered[i].status == hard || filtered[i].status == decided {
+					candidates = append(candidates, candidate{tmpFormulas[i], filtered[i]})
+				}
+				if numFitting+kept < numFormulas && roundsMix.accept(filtered[i]) {
+					kept++
+				}
+			}
 
-		filterRounds++
+			filterRounds++
 
-		// display info on generation
-		logger.Print("Round ", filterRounds, ", kept ", len(toKeep), " formulas, ", numFormulas-numFound, " to go")
+			// display info on generation
+			logger.Print("Round ", filterRounds, ", kept ", kept, " formulas (", roundsMix.summary(), "), rejected ", current.duplicates, " duplicates, ", numFormulas-numFitting-kept, " to go")
+		}
+
+		// change the state budget and the depth if formulas are kept too
+		// slowly, the rounds of a group share them so this is done once per
+		// group, counting the groups left
+		if left := globalConfiguration.MaxFilterTries - filterRounds; left > 0 && esc.update(before, roundsMix, (left+numRounds-1)/numRounds) {
+			logger.Print("Next rounds with a budget of ", esc.budget, " states and formulas of depth ", esc.depth)
+		}
+	}
+
+	// select the formulas fitting the mix of verdicts, in the order given by
+	// the selection strategy
+	mix := newVerdictMix(numFormulas)
+	leftovers := make([]candidate, 0) // filtered formulas not selected because of the mix
+	for _, c := range orderCandidates(candidates, numFormulas) {
+		if numFound >= numFormulas || !mix.accept(c.result) {
+			leftovers = append(leftovers, c)
+			continue
+		}
+		formulas[numFound] = c.formula
+		results[numFound] = c.result
+		numFound++
+	}
+	logger.Print("Selected ", numFound, " formulas (", mix.summary(), ") among ", len(candidates), " filtered ones, ", globalConfiguration.Selection, " selection")
+
+	// if not enough formulas, complete with the filtered formulas that did
+	// not fit in the mix of verdicts, hard ones first
+	if numFound < numFormulas && len(leftovers) > 0 {
+		sort.SliceStable(leftovers, func(i, j int) bool {
+			return leftovers[i].result.status == hard && leftovers[j].result.status != hard
+		})
+		added := 0
+		for _, c := range leftovers {
+			if numFound >= numFormulas {
+				break
+			}
+			formulas[numFound] = c.formula
+			results[numFound] = c.result
+			numFound++
+			added++
+		}
+		logger.Print("Added ", added, " filtered formulas not fitting the mix of verdicts")
 	}
 
-	// if not enough formulas, complete with completely random ones
+	// if still not enough formulas, complete with filtered formulas of a
+	// smaller depth (with random ones at the smallest depth), or fail
+	if numFound < numFormulas && globalConfiguration.Fallback == "fail" {
+		return nil, nil, fmt.Errorf("found only %d formulas out of %d", numFound, numFormulas)
+	}
+	if numFound < numFormulas && globalConfiguration.Fallback == "shallower" && depth <= minFormulaDepth {
+		logger.Print("Depth ", depth, " is the smallest one for filtered formulas, keeping the ", numFound, " formulas found")
+	}
+	if numFound < numFormulas && globalConfiguration.Fallback == "shallower" && depth > minFormulaDepth {
+		logger.Print("Found only ", numFound, " formulas, will add filtered formulas of depth ", depth-1, " to go up to ", numFormulas)
+		shallower, shallowerResults, err := m.genericGeneration(numFormulas-numFound, depth-1, canUnfold, generation, seen, logger, fmt.Sprint(job, "-depth", depth-1))
+		if err != nil {
+			return nil, nil, fmt.Errorf("found only %d formulas of depth %d out of %d, %w", numFound, depth, numFormulas, err)
+		}
+		copy(formulas[numFound:], shallower)
+		copy(results[numFound:], shallowerResults)
+		numFound = numFormulas
+	}
+
+	// if still not enough formulas, complete with completely random ones,
+	// avoiding duplicates as far as possible
 	if numFound < numFormulas {
 		logger.Print("Found only ", numFound, " formulas, will add random ones to go up to ", numFormulas)
+		duplicates := 0
 		for ; numFound < numFormulas; numFound++ {
-			formulas[numFound] = generation(depth, *m)
+			f, err := generation(depth, *m)
+			for tries := 1; err == nil && seen[f.key()] && tries < maxDuplicateTries; tries++ {
+				duplicates++
+				f, err = generation(depth, *m)
+			}
+			if err != nil {
+				return nil, nil, err
+			}
+			formulas[numFound] = f
+			results[numFound] = filterResult{status: skipped, verdict: unknownVerdict, states: -1}
+			results[numFound].difficulty = newDifficulty(f, results[numFound], esc.budget)
+			seen[f.key()] = true
 		}
+		logger.Print("Rejected ", duplicates, " duplicates among random formulas")
 	}
 
-	return formulas
+	return formulas, results, nil
+}
+
+// formulas generated for a filtering round, and their filtering
+type batch struct {
+	formulas   []formula
+	duplicates int // formulas rejected as duplicates when generating the batch
+	results    []filterResult
+	err        error
+}
+
+// a filtered formula
+type candidate struct {
+	formula formula
+	result  filterResult
 }
@@ -0,0 +1,429 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// configuration of a test, the default one with some changes, restored at
+// the end of the test
+func setTestConfig(t *testing.T, change func(c *config)) {
+	t.Helper()
+	saved := globalConfiguration
+	t.Cleanup(func() { globalConfiguration = saved })
+	globalConfiguration = defaultConfiguration
+	globalConfiguration.NumFormulas = 4
+	globalConfiguration.NumUnfold = 2
+	globalConfiguration.FilterSetSize = 6
+	globalConfiguration.MaxFilterTries = 2
+	globalConfiguration.SMCMaxStates = 50
+	globalConfiguration.MaxIntegerConstant = 5
+	if change != nil {
+		change(&globalConfiguration)
+	}
+}
+
+// copy the models of testdata/models in a temporary input directory, as
+// generation writes its files next to the models
+func copyTestModels(t *testing.T) string {
+	t.Helper()
+	inputDir := t.TempDir()
+	models, err := os.ReadDir(filepath.Join("testdata", "models"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range models {
+		content, err := os.ReadFile(filepath.Join("testdata", "models", m.Name(), "model.pnml"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Mkdir(filepath.Join(inputDir, m.Name()), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(inputDir, m.Name(), "model.pnml"), content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return inputDir
+}
+
+// generate formulas for the test models with the configuration of the test
+// (reversing the order in which models are handled if asked), and give the
+// content of the files written for each examination, by model directory and
+// file name
+func generatedFiles(t *testing.T, reverse bool) map[string]string {
+	t.Helper()
+	inputDir := copyTestModels(t)
+	models := selectModels(listModels(inputDir))
+	if reverse {
+		for i, j := 0, len(models)-1; i < j; i, j = i+1, j-1 {
+			models[i], models[j] = models[j], models[i]
+		}
+	}
+	generateModels(models)
+
+	files := make(map[string]string)
+	for _, e := range selectedExaminations() {
+		for _, name := range []string{e.xmlFileName, e.hrFileName, e.verdictsFileName, e.metadataFileName} {
+			paths, err := filepath.Glob(filepath.Join(inputDir, "*", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, path := range paths {
+				content, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rel, _ := filepath.Rel(inputDir, path)
+				files[rel] = string(content)
+			}
+		}
+	}
+	if len(files) == 0 {
+		t.Fatal("no file written")
+	}
+	return files
+}
+
+// compare the files written by two generations
+func compareFiles(t *testing.T, what string, expected, got map[string]string) {
+	t.Helper()
+	for name, content := range expected {
+		other, written := got[name]
+		switch {
+		case !written:
+			t.Errorf("%s: %s not written", what, name)
+		case other != content:
+			t.Errorf("%s: %s differs:\n%s\ninstead of:\n%s", what, name, other, content)
+		}
+	}
+	for name := range got {
+		if _, written := expected[name]; !written {
+			t.Errorf("%s: %s written only once", what, name)
+		}
+	}
+}
+
+func TestGenerationReproducible(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generation for all the test models")
+	}
+	setTestConfig(t, func(c *config) { c.Seed = 42 })
+	reference := generatedFiles(t, false)
+	for name, content := range reference {
+		if strings.HasSuffix(name, ".xml") && !strings.Contains(content, "<property>") {
+			t.Errorf("no formula in %s", name)
+		}
+	}
+
+	compareFiles(t, "same seed", reference, generatedFiles(t, false))
+	compareFiles(t, "models in reverse order", reference, generatedFiles(t, true))
+	globalConfiguration.NumProc = 3
+	compareFiles(t, "3 models at a time", reference, generatedFiles(t, false))
+
+	globalConfiguration.NumProc = 1
+	globalConfiguration.Seed = 43
+	other := generatedFiles(t, false)
+	differs := false
+	for name, content := range other {
+		differs = differs || strings.HasSuffix(name, ".xml") && reference[name] != content
+	}
+	if !differs {
+		t.Error("another seed gives the same formulas")
+	}
+}
+
+// with groups of rounds filtered concurrently and escalation between the
+// groups, the formulas still depend only on the seed, not on the number of
+// workers
+func TestGenerationParallelRounds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generation for all the test models")
+	}
+	setTestConfig(t, func(c *config) {
+		c.Seed = 42
+		c.ParallelRounds = 3
+		c.MaxFilterTries = 6
+		c.StateBudgetGrowth = 2
+		c.DepthGrowth = 1
+		c.MaxFormulaDepth = 5
+	})
+	reference := generatedFiles(t, false)
+	for _, numProc := range []int{2, 4} {
+		globalConfiguration.NumProc = numProc
+		compareFiles(t, fmt.Sprint(numProc, " workers"), reference, generatedFiles(t, numProc == 4))
+	}
+}
+
+// UpperBounds formulas on places whose bound is the initial marking are
+// never selected, even when decided formulas are
+func TestGenerationUpperBounds(t *testing.T) {
+	setTestConfig(t, func(c *config) {
+		c.UnknownShare = 0
+		c.FilterSetSize = 4
+		c.MaxFilterTries = 5
+	})
+	m := &modelInfo{modelType: pt, net: boundsNet(), places: []string{"p0", "p1", "p2", "p3"}, rng: newModelRand(0, "bounds")}
+	formulas, results, err := m.genericGeneration(2, 1, true, genUpperBoundsFormula, make(map[string]bool), log.New(io.Discard, "", 0), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected := make(map[string]bool)
+	for i, f := range formulas {
+		selected[f.ashr()] = true
+		if results[i].status != decided {
+			t.Errorf("%s selected with status %v", f.ashr(), results[i].status)
+		}
+	}
+	for _, f := range []string{`place-bound("p1")`, `place-bound("p3")`} {
+		if !selected[f] {
+			t.Errorf("%s not selected", f)
+		}
+	}
+}
+
+// a generation of formulas on unboundedNet whose filtering is known, following
+// a script for each depth: H gives hard formulas, T and F formulas decided
+// TRUE and FALSE, and I formulas decided on the initial marking, once the
+// script is done formulas are decided on the initial marking, the kind of
+// each generated formula is recorded by key
+type scriptedGeneration struct {
+	scripts map[int]string
+	calls   map[int]int
+	kinds   map[string]byte
+}
+
+func newScriptedGeneration(scripts map[int]string) *scriptedGeneration {
+	return &scriptedGeneration{scripts: scripts, calls: make(map[int]int), kinds: make(map[string]byte)}
+}
+
+func (g *scriptedGeneration) generate(depth int, m modelInfo) (formula, error) {
+	A, E := allPathsOperator, existsPathOperator
+	G, F := globallyOperator, finallyOperator
+	n := len(g.kinds)
+	kind := byte('I')
+	if script := g.scripts[depth]; g.calls[depth] < len(script) {
+		kind = script[g.calls[depth]]
+	}
+	g.calls[depth]++
+	var f formula
+	switch kind {
+	case 'H':
+		f = modal(E, F, leq(integer(1000+n), tokens("p0")))
+	case 'T':
+		f = modal(E, F, leq(integer(n+1), tokens("p0")))
+	case 'F':
+		f = modal(A, G, leq(tokens("p0"), integer(n)))
+	default:
+		f = modal(A, G, leq(integer(n+1), tokens("p0")))
+	}
+	g.kinds[f.key()] = kind
+	return f, nil
+}
+
+// the kinds of a set of generated formulas
+func (g *scriptedGeneration) kindsOf(formulas []formula) string {
+	kinds := make([]byte, len(formulas))
+	for i, f := range formulas {
+		kinds[i] = g.kinds[f.key()]
+	}
+	return string(kinds)
+}
+
+// generate formulas on unboundedNet with a scripted generation
+func scriptedFormulas(t *testing.T, numFormulas, depth int, g *scriptedGeneration) ([]formula, []filterResult, error) {
+	t.Helper()
+	m := &modelInfo{modelName: "Toy", modelType: pt, modelInstance: "001", net: unboundedNet()}
+	return m.genericGeneration(numFormulas, depth, true, g.generate, make(map[string]bool), log.New(io.Discard, "", 0), "job")
+}
+
+// the mix of verdicts is filled across filtering rounds, rounds stop once it
+// is, and the filtered formulas that did not fit complete it, hard ones first
+func TestGenerationMix(t *testing.T) {
+	tests := []struct {
+		name                string
+		unknown, minT, minF float64
+		maxTries            int
+		script              string
+		kinds               string
+		calls               int
+	}{
+		{"share across rounds", 0.5, 0.5, 0.5, 4, "TTT" + "HFH" + "HHH", "THFH", 6},
+		{"decided in later rounds", 0.5, 0.25, 0.25, 4, "HHH" + "HIT" + "IFT", "HHTF", 9},
+		{"leftovers", 0.5, 0.5, 0, 2, "TTT" + "TFT", "TTTT", 6},
+		{"hard leftovers first", 0.25, 0, 0.34, 2, "HHT" + "TTT", "HTTH", 6},
+		{"random formulas at last", 0.5, 0, 0, 2, "HII" + "III", "HIII", 9},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.UnknownShare = test.unknown
+				c.MinTrueShare = test.minT
+				c.MinFalseShare = test.minF
+				c.MaxFilterTries = test.maxTries
+				c.FilterSetSize = 3
+				c.SMCMaxStates = 100
+			})
+			g := newScriptedGeneration(map[int]string{2: test.script})
+			formulas, _, err := scriptedFormulas(t, 4, 2, g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kinds := g.kindsOf(formulas); kinds != test.kinds {
+				t.Errorf("formulas %s, expected %s", kinds, test.kinds)
+			}
+			if g.calls[2] != test.calls {
+				t.Errorf("%d formulas generated, expected %d", g.calls[2], test.calls)
+			}
+		})
+	}
+}
+
+// the fallbacks complete the formulas found by the rounds with filtered
+// formulas of a smaller depth, with random ones, or not at all
+func TestGenerationFallback(t *testing.T) {
+	tests := []struct {
+		name     string
+		fallback string
+		scripts  map[int]string
+		depth    int
+		kinds    string
+		fails    bool
+	}{
+		{"random", "random", map[int]string{3: "HII"}, 3, "HII", false},
+		{"shallower", "shallower", map[int]string{3: "HII", 2: "HHH"}, 3, "HHH", false},
+		{"random at the smallest depth", "shallower", map[int]string{3: "HII", 2: "HII"}, 3, "HHI", false},
+		{"shallower from the smallest depth", "shallower", map[int]string{2: "HII"}, 2, "HII", false},
+		{"fail", "fail", map[int]string{3: "HII"}, 3, "", true},
+		{"fail when shallower", "fail", map[int]string{3: "HHH"}, 3, "HHH", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.UnknownShare = 1
+				c.MaxFilterTries = 1
+				c.FilterSetSize = 3
+				c.SMCMaxStates = 100
+				c.Fallback = test.fallback
+			})
+			g := newScriptedGeneration(test.scripts)
+			formulas, _, err := scriptedFormulas(t, 3, test.depth, g)
+			if test.fails {
+				if err == nil {
+					t.Errorf("no error, formulas %s", g.kindsOf(formulas))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kinds := g.kindsOf(formulas); kinds != test.kinds {
+				t.Errorf("formulas %s, expected %s", kinds, test.kinds)
+			}
+		})
+	}
+}
+
+func TestCheckNumUnfold(t *testing.T) {
+	tests := []struct {
+		numUnfold int
+		valid     bool
+	}{
+		{0, true}, {2, true}, {4, true}, {5, false}, {-1, false},
+	}
+	for _, test := range tests {
+		setTestConfig(t, func(c *config) { c.NumUnfold = test.numUnfold })
+		if err := checkNumUnfold(); (err == nil) != test.valid {
+			t.Errorf("NumUnfold %d with NumFormulas 4: error %v", test.numUnfold, err)
+		}
+	}
+}
+
+// the PT twin of a COL model gets the unfolded formulas of the COL model
+// (as many as there are) and formulas of its own, or only formulas of its
+// own when generation failed for the COL model
+func TestGenerationTwin(t *testing.T) {
+	tests := []struct {
+		name          string
+		fallback      string
+		numUnfold     int
+		script        string
+		colFormulas   int // formulas written for the COL model
+		twinGenerated int // formulas generated for the twin
+	}{
+		{"unfolded formulas", "random", 1, "HHH" + "HHH", 2, 3},
+		{"COL generation failed", "fail", 1, "HII" + "HHH", 0, 3},
+		{"more formulas to unfold than generated", "random", 3, "HHH", 2, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.UnknownShare = 1
+				c.MaxFilterTries = 1
+				c.FilterSetSize = 3
+				c.SMCMaxStates = 100
+				c.Fallback = test.fallback
+			})
+			g := newScriptedGeneration(map[int]string{2: test.script})
+			e := examination{"Toy", g.generate, "Toy.xml", "Toy.txt", "Toy.verdicts", "Toy.json", "Toy"}
+			m := &modelInfo{directory: t.TempDir(), modelName: "Toy", modelType: col, modelInstance: "001", net: unboundedNet()}
+			m.twinModel = &modelInfo{
+				directory:          t.TempDir(),
+				modelName:          "Toy",
+				modelType:          pt,
+				modelInstance:      "001",
+				twinModel:          m,
+				net:                unboundedNet(),
+				placesMapping:      map[string][]string{"p0": {"p0"}},
+				transitionsMapping: map[string][]string{"t0": {"t0"}},
+			}
+			m.genericGenerationAndWriting(2, 2, test.numUnfold, true, e, log.New(io.Discard, "", 0))
+
+			if n := countVerdicts(t, m.directory, e); n != test.colFormulas {
+				t.Errorf("%d formulas written for the COL model, expected %d", n, test.colFormulas)
+			}
+			if n := countVerdicts(t, m.twinModel.directory, e); n != 2 {
+				t.Errorf("%d formulas written for the PT model, expected 2", n)
+			}
+			if generated := g.calls[2] - 3; generated != test.twinGenerated {
+				t.Errorf("%d formulas generated for the PT model, expected %d", generated, test.twinGenerated)
+			}
+		})
+	}
+}
+
+// the number of verdicts written for an examination in a directory
+func countVerdicts(t *testing.T, directory string, e examination) int {
+	t.Helper()
+	content, err := os.ReadFile(filepath.Join(directory, e.verdictsFileName))
+	if os.IsNotExist(err) {
+		return 0
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Count(string(content), "FORMULA ")
+}
@@ -18,33 +18,45 @@ along with this program.  If not, see https://www.gnu.org/licenses/.
 
 package main
 
-//var randomGenerator *rand.Rand
-
 const (
-	year                               string = "2024"
-	version                            string = "v2024"
-	CTLFireabilityXMLFileName          string = "CTLFireability.xml"
-	CTLCardinalityXMLFileName          string = "CTLCardinality.xml"
-	ReachabilityFireabilityXMLFileName string = "ReachabilityFireability.xml"
-	ReachabilityCardinalityXMLFileName string = "ReachabilityCardinality.xml"
-	CTLFireabilityHRFileName           string = "CTLFireability.txt"
-	CTLCardinalityHRFileName           string = "CTLCardinality.txt"
-	ReachabilityFireabilityHRFileName  string = "ReachabilityFireability.txt"
-	ReachabilityCardinalityHRFileName  string = "ReachabilityCardinality.txt"
+	year    string = "2024"
+	version string = "v2024"
 )
 
 var defaultConfiguration config = config{
-	MaxArity:               2,        // max arity for operators
-	MaxFireabilityAtomSize: 1,        // max number of transitions in any atom
-	MaxCardinalityAtomSize: 1,        // max number of places in any atom
-	MinIntegerConstant:     0,        // min constant to appear in integere comparisions in formulas
-	MaxIntegerConstant:     100,      // max constant to appear in integer comparisons in formulas
-	InputDir:               "INPUTS", // where to find the models
-	NumFormulas:            16,       // number of formulas to generate
-	NumUnfold:              8,        // number of formulas from COL models to unfold for generating formulas for PT models
-	FormulaDepth:           2,        // maximum depth of generated formulas
-	MaxFilterTries:         3,        // maximum number of call to SMC per model
-	FilterSetSize:          16,       // number of formula to generate for one round of SMC filtering
+	MaxArity:               2,               // max arity for operators
+	MaxFireabilityAtomSize: 1,               // max number of transitions in any atom
+	MaxCardinalityAtomSize: 1,               // max number of places in any atom
+	MinIntegerConstant:     0,               // min constant to appear in integere comparisions in formulas
+	MaxIntegerConstant:     100,             // max constant to appear in integer comparisons in formulas
+	InputDir:               "INPUTS",        // where to find the models
+	IncludeModels:          nil,             // patterns of the models to consider (all if empty)
+	ExcludeModels:          nil,             // patterns of the models to ignore
+	ModelTypes:             nil,             // types of the models to consider: COL and/or PT (all if empty)
+	NumFormulas:            16,              // number of formulas to generate
+	Examinations:           nil,             // examinations to generate formulas for (all if empty)
+	NumUnfold:              8,               // number of formulas from COL models to unfold for generating formulas for PT models, at most NumFormulas
+	MappingFile:            "mapping.json",  // explicit mapping of nodes from COL models to PT models, in the directory of COL models
+	StructuralAnalysis:     true,            // exclude dead transitions and constant places from generation
+	StructureFile:          "structure.txt", // report of the structural analysis, in the directory of models
+	FormulaDepth:           2,               // maximum depth of generated formulas
+	MaxFilterTries:         3,               // maximum number of call to SMC per model
+	ParallelRounds:         1,               // number of filtering rounds generated at once and filtered concurrently, escalation happens between groups of rounds
+	FilterSetSize:          16,              // number of formula to generate for one round of SMC filtering
+	StateBudgetGrowth:      1,               // factor applied to the state budget when rounds give too few decided formulas
+	MaxStateBudget:         0,               // largest state budget, 0 for no limit
+	DepthGrowth:            0,               // depth added to formulas when rounds give too few hard formulas
+	MaxFormulaDepth:        0,               // largest depth of formulas, 0 for no limit
+	Fallback:               "random",        // completion of sets with too few filtered formulas: random, shallower or fail
+	Checker:                "native",        // model checker used for filtering formulas: native, smc or benchkit
+	CheckerCommand:         "",              // command template for running a benchkit checker
+	CheckerTimeout:         600,             // time limit (in seconds) for a run of an external checker, 0 for none
+	CheckerMemory:          0,               // memory limit (in MB) for a run of an external checker, 0 for none
+	TimeoutPolicy:          "hard",          // formulas without verdict when the checker times out are kept (hard) or not (unknown)
+	UnknownShare:           1,               // share of the formulas that must not be decided by the checker
+	MinTrueShare:           0,               // minimal share of TRUE formulas among the decided ones
+	MinFalseShare:          0,               // minimal share of FALSE formulas among the decided ones
+	Selection:              "first",         // order of selection of filtered formulas: first (generated), hardest or spread (of difficulties)
 	SMCPath:                "smc.py",
 	SMCTmpFileName:         "tmp",
 	SMClogfile:             "smclog",
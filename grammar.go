@@ -27,6 +27,7 @@ type operator struct {
 var atom operator = operator{"atom", 0, 0, false}
 var isfireable operator = operator{name: "is-fireable"}
 var tokencount operator = operator{name: "tokens-count"}
+var placebound operator = operator{name: "place-bound"}
 var leqOperator operator = operator{"leq", 2, 2, false}
 var integerconstant operator = operator{"integer-constant", 1, 1, false}
 var allPathsOperator operator = operator{"A", 1, 1, false}
@@ -36,6 +37,17 @@ var finallyOperator operator = operator{"F", 1, 1, false}
 var nextOperator operator = operator{"X", 1, 1, false}
 var untilOperator operator = operator{"U", 2, 2, false}
 
+// boolean operators for formulas read from files, their maximum arity
+// is set to their actual number of operands
+var notOperator operator = operator{"not", 1, 1, true}
+var andOperator operator = operator{"and", 2, 0, true}
+var orOperator operator = operator{"or", 2, 0, true}
+
+// constants, only used during simplification (they cannot appear in
+// generated formulas)
+var trueConstant operator = operator{name: "true"}
+var falseConstant operator = operator{name: "false"}
+
 var booleanOperators []operator
 
 var pathOperators []operator = []operator{
@@ -47,6 +59,8 @@ var pathOperators []operator = []operator{
 
 var stateOperators []operator
 
+var ltlOperators []operator
+
 func initBooleanOperators() {
 	booleanOperators = []operator{
 		atom,
@@ -66,3 +80,16 @@ func initStateOperators() {
 		{"or", 2, globalConfiguration.MaxArity, true},
 	}
 }
+
+func initLTLOperators() {
+	ltlOperators = []operator{
+		atom,
+		{"not", 1, 1, true},
+		{"and", 2, globalConfiguration.MaxArity, true},
+		{"or", 2, globalConfiguration.MaxArity, true},
+		globallyOperator,
+		finallyOperator,
+		nextOperator,
+		untilOperator,
+	}
+}
@@ -0,0 +1,155 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "strconv"
+
+// Evaluation of a formula (CTL or LTL) on the initial marking only. All the
+// paths of the net start in the initial marking, so a path formula can be
+// evaluated on the first position of any of them: G phi is false if phi is,
+// F phi is true if phi is, phi U psi is true if psi is and false if both phi
+// and psi are. A place-bound is given by the initial marking if no transition
+// adds tokens to its places. Anything else depending on other markings (X,
+// ...) is unknown. This is much cheaper than exploring the state space and decides
+// all the formulas that are trivial because of the initial marking.
+func (net *petriNet) evalInitial(f formula) verdict {
+	switch f.operator.name {
+	case "not":
+		switch net.evalInitial(f.operand[0]) {
+		case trueVerdict:
+			return falseVerdict
+		case falseVerdict:
+			return trueVerdict
+		}
+	case "and", "or":
+		absorbing, neutral := falseVerdict, trueVerdict
+		if f.operator.name == "or" {
+			absorbing, neutral = trueVerdict, falseVerdict
+		}
+		res := neutral
+		for _, operand := range f.operand {
+			switch net.evalInitial(operand) {
+			case absorbing:
+				return absorbing
+			case unknownVerdict:
+				res = unknownVerdict
+			}
+		}
+		return res
+	case "A", "E":
+		return net.evalInitial(f.operand[0])
+	case "G":
+		if net.evalInitial(f.operand[0]) == falseVerdict {
+			return falseVerdict
+		}
+	case "F":
+		if net.evalInitial(f.operand[0]) == trueVerdict {
+			return trueVerdict
+		}
+	case "U":
+		reach := net.evalInitial(f.operand[1])
+		if reach == trueVerdict {
+			return trueVerdict
+		}
+		if reach == falseVerdict && net.evalInitial(f.operand[0]) == falseVerdict {
+			return falseVerdict
+		}
+	case "is-fireable":
+		for _, tr := range f.operand {
+			num, exists := net.transitionIndex[tr.operator.name]
+			if !exists {
+				return unknownVerdict
+			}
+			if net.isEnabled(net.initialMarking, num) {
+				return trueVerdict
+			}
+		}
+		return falseVerdict
+	case "place-bound":
+		if _, known := net.initialBound(f); known {
+			return boundVerdict
+		}
+	case "leq":
+		left, leftKnown := net.evalInitialInteger(f.operand[0])
+		right, rightKnown := net.evalInitialInteger(f.operand[1])
+		if !leftKnown || !rightKnown {
+			return unknownVerdict
+		}
+		if left <= right {
+			return trueVerdict
+		}
+		return falseVerdict
+	}
+	return unknownVerdict
+}
+
+// value of an integer expression in the initial marking, if it can be computed
+func (net *petriNet) evalInitialInteger(f formula) (int, bool) {
+	switch f.operator.name {
+	case "integer-constant":
+		c, err := strconv.Atoi(f.operand[0].operator.name)
+		return c, err == nil
+	case "tokens-count":
+		tokens := 0
+		for _, p := range f.operand {
+			num, exists := net.placeIndex[p.operator.name]
+			if !exists {
+				return 0, false
+			}
+			tokens += net.initialMarking[num]
+		}
+		return tokens, true
+	}
+	return 0, false
+}
+
+// number of tokens initially in the places of a place-bound formula
+func (net *petriNet) initialTokens(f formula) (int, bool) {
+	return net.evalInitialInteger(formula{operator: tokencount, operand: f.operand})
+}
+
+// bound of a place-bound formula when no transition can increase the number
+// of tokens in its places: the number of tokens they initially hold
+func (net *petriNet) initialBound(f formula) (int, bool) {
+	tokens, known := net.initialTokens(f)
+	if !known {
+		return 0, false
+	}
+	inSet := make(map[int]bool)
+	for _, p := range f.operand {
+		inSet[net.placeIndex[p.operator.name]] = true
+	}
+	for t := range net.transitions {
+		delta := 0
+		for _, a := range net.pre[t] {
+			if inSet[a.place] {
+				delta -= a.weight
+			}
+		}
+		for _, a := range net.post[t] {
+			if inSet[a.place] {
+				delta += a.weight
+			}
+		}
+		if delta > 0 {
+			return 0, false
+		}
+	}
+	return tokens, true
+}
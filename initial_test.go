@@ -0,0 +1,75 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "testing"
+
+func TestEvalInitial(t *testing.T) {
+	// p0 = 1, p1 = 0: t0 is fireable and t1 is not
+	net := cycleNet()
+	tests := []struct {
+		formula string
+		verdict verdict
+	}{
+		{`is-fireable("t0")`, trueVerdict},
+		{`is-fireable("t1")`, falseVerdict},
+		{`is-fireable("t1", "t0")`, trueVerdict},
+		{`is-fireable("unknown")`, unknownVerdict},
+		{`tokens-count("p0", "p1") <= 1`, trueVerdict},
+		{`2 <= tokens-count("p0")`, falseVerdict},
+		{`tokens-count("unknown") <= 1`, unknownVerdict},
+		{`! is-fireable("t1")`, trueVerdict},
+		{`is-fireable("t0") & is-fireable("t1")`, falseVerdict},
+		{`is-fireable("t0") | is-fireable("t1")`, trueVerdict},
+		{`is-fireable("t0") & E F is-fireable("t1")`, unknownVerdict},
+		{`is-fireable("t1") & E F is-fireable("t1")`, falseVerdict},
+		{`A G is-fireable("t1")`, falseVerdict},
+		{`A G is-fireable("t0")`, unknownVerdict},
+		{`E F is-fireable("t0")`, trueVerdict},
+		{`E F is-fireable("t1")`, unknownVerdict},
+		{`A (is-fireable("t1") U is-fireable("t0"))`, trueVerdict},
+		{`A (is-fireable("t1") U 1 <= tokens-count("p1"))`, falseVerdict},
+		{`A (is-fireable("t0") U is-fireable("t1"))`, unknownVerdict},
+		{`A X is-fireable("t1")`, unknownVerdict},
+		{`place-bound("p0")`, unknownVerdict},
+	}
+	for _, test := range tests {
+		if v := net.evalInitial(mustParse(t, test.formula)); v != test.verdict {
+			t.Errorf("%s: %v, expected %v", test.formula, v, test.verdict)
+		}
+	}
+
+	// no transition adds tokens to p0 nor to p0 and p1 together
+	net = boundsNet()
+	tests = []struct {
+		formula string
+		verdict verdict
+	}{
+		{`place-bound("p0")`, boundVerdict},
+		{`place-bound("p1")`, unknownVerdict},
+		{`place-bound("p2")`, unknownVerdict},
+		{`place-bound("p0", "p1")`, boundVerdict},
+		{`place-bound("p0", "unknown")`, unknownVerdict},
+	}
+	for _, test := range tests {
+		if v := net.evalInitial(mustParse(t, test.formula)); v != test.verdict {
+			t.Errorf("%s: %v, expected %v", test.formula, v, test.verdict)
+		}
+	}
+}
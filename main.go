@@ -19,27 +19,72 @@ along with this program.  If not, see https://www.gnu.org/licenses/.
 package main
 
 import (
-	"flag"
 	"fmt"
 	"log"
 	"os"
 	"runtime"
+	"strings"
 )
 
 func main() {
 
-	configFile := flag.String("conf", "config.json", "path to the configuration file")
+	// without command name, generate formulas (for compatibility with older versions)
+	name := "generate"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
 
-	flag.Parse()
-	getConfig(*configFile)
+	for _, c := range commands {
+		if c.name == name {
+			c.run(args)
+			return
+		}
+	}
 
-	//randomGenerator = rand.New(rand.NewSource(globalConfiguration.Seed))
+	fmt.Fprint(os.Stderr, "Unknown command ", name, ", available commands are:\n")
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", c.name, c.description)
+	}
+	os.Exit(2)
+}
+
+// generate formulas for all the models of the input directory
+func generateCommand(args []string) {
+
+	flags, configFile := commandFlags("generate")
+	selection := addModelSelectionFlags(flags)
+	exams := flags.String("examinations", "", "comma-separated examinations to generate formulas for (overrides Examinations)")
+	flags.Parse(args)
+	getConfig(*configFile)
+	selection.apply()
+	if *exams != "" {
+		globalConfiguration.Examinations = strings.Split(*exams, ",")
+	}
+	selectedExaminations() // check the examinations names before any work
+	if _, err := newChecker(globalConfiguration.SMCMaxStates); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkVerdictMix(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkSelection(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkEscalation(); err != nil {
+		log.Fatal(err)
+	}
+	if err := checkNumUnfold(); err != nil {
+		log.Fatal(err)
+	}
 
 	log.Print(
 		"Working with:\n",
 		"\t", "cores: ", globalConfiguration.NumProc, "\n",
+		"\t", "seed: ", globalConfiguration.Seed, "\n",
 		"\t", "models directory: ", globalConfiguration.InputDir, "\n",
 		"\t", "number of generated formulas per model: ", globalConfiguration.NumFormulas, "\n",
+		"\t", "examinations: ", examinationNames(selectedExaminations()), "\n",
 		"\t", "number of unfolded formulas per COL/PT cuple: ", globalConfiguration.NumUnfold, "\n",
 		"Formulas characteristics:\n",
 		"\t", "maximum depth: ", globalConfiguration.FormulaDepth, "\n",
@@ -48,8 +93,16 @@ func main() {
 		"\t", "maximum number of places per atom: ", globalConfiguration.MaxCardinalityAtomSize, "\n",
 		"\t", "maximum integer constant used in comparisons: ", globalConfiguration.MaxIntegerConstant, "\n",
 		"Formulas filtering:\n",
-		"\t", "number of filtering rounds per model: ", globalConfiguration.MaxFilterTries, "\n",
+		"\t", "number of filtering rounds per model: ", globalConfiguration.MaxFilterTries, " (", globalConfiguration.ParallelRounds, " at once)\n",
 		"\t", "number of generated formulas at each filtering round: ", globalConfiguration.FilterSetSize, "\n",
+		"\t", "escalation between rounds: state budget x", globalConfiguration.StateBudgetGrowth, " (limit ", globalConfiguration.MaxStateBudget, "), depth +", globalConfiguration.DepthGrowth, " (limit ", globalConfiguration.MaxFormulaDepth, ")\n",
+		"\t", "completion of sets with too few formulas: ", globalConfiguration.Fallback, "\n",
+		"\t", "model checker: ", globalConfiguration.Checker, "\n",
+		"\t", "model checker command (benchkit): ", globalConfiguration.CheckerCommand, "\n",
+		"\t", "model checker limits: ", globalConfiguration.CheckerTimeout, " s, ", globalConfiguration.CheckerMemory, " MB\n",
+		"\t", "timed out formulas: ", globalConfiguration.TimeoutPolicy, "\n",
+		"\t", "verdicts: ", globalConfiguration.UnknownShare, " undecided, at least ", globalConfiguration.MinTrueShare, " TRUE and ", globalConfiguration.MinFalseShare, " FALSE among decided\n",
+		"\t", "selection of formulas: ", globalConfiguration.Selection, "\n",
 		"\t", "tmp file location: ", globalConfiguration.SMCTmpFileName, "\n",
 		"SMC configuration:\n",
 		"\t", "path: ", globalConfiguration.SMCPath, "\n",
@@ -61,11 +114,17 @@ func main() {
 	oldNumProc := runtime.GOMAXPROCS(globalConfiguration.NumProc)
 	log.Print("Switching from ", oldNumProc, " cores (default) to ", globalConfiguration.NumProc, " cores")
 
-	models := listModels(globalConfiguration.InputDir)
+	generateModels(selectModels(listModels(globalConfiguration.InputDir)))
+}
+
+// generate formulas for a set of models, NumProc models at a time
+func generateModels(models []*modelInfo) {
 
 	initBooleanOperators() // for CTL only
 	initStateOperators()   // for reachability only
+	initLTLOperators()     // for LTL only
 
+	workers = newWorkerPool(globalConfiguration.NumProc)
 	routineNum := 0
 	doneChan := make(chan int, globalConfiguration.NumProc)
 	for pos := range models {
@@ -109,6 +168,6 @@ func handleModel(pos int, models []*modelInfo, numFormulas, formulaDepth, numUnf
 	logger.Print("Starting goroutine")
 
 	logger.Print("generating formulas")
-	m.genFormulas(numFormulas, formulaDepth, numUnfold, logger, routineNum)
+	m.genFormulas(numFormulas, formulaDepth, numUnfold, logger)
 
 }
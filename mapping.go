@@ -0,0 +1,338 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// a mapping of the nodes of a COL model to the nodes of its PT twin, as
+// found in the directory of the COL model: either written by hand, or
+// saved by Citili with the hashes of the pnml files it was computed from
+type mappingFile struct {
+	COLHash             string              `json:"colHash,omitempty"`
+	PTHash              string              `json:"ptHash,omitempty"`
+	Places              map[string][]string `json:"places"`
+	Transitions         map[string][]string `json:"transitions"`
+	UnmappedPlaces      []string            `json:"unmappedPlaces,omitempty"`
+	UnmappedTransitions []string            `json:"unmappedTransitions,omitempty"`
+}
+
+// diagnostic of the mapping of the nodes of a COL model to the nodes
+// of its PT twin
+type mappingReport struct {
+	source      string // where the mapping comes from
+	places      nodesReport
+	transitions nodesReport
+}
+
+// diagnostic of the mapping of one kind of nodes (places or transitions)
+type nodesReport struct {
+	kind       string
+	structural int                 // PT nodes mapped using the color domain of their COL node
+	prefix     int                 // PT nodes mapped using only the prefix of their id
+	explicit   int                 // PT nodes mapped by the mapping file
+	ambiguous  map[string][]string // PT nodes that could come from several COL nodes
+	orphanPT   []string            // PT nodes not unfolded from any COL node
+	orphanCOL  []string            // COL nodes not unfolded to any PT node
+	unknown    []string            // ids of the mapping file that are not nodes of the models
+}
+
+// map the nodes of the twin COL model to the nodes of a PT model
+func (m *modelInfo) mapids(logger *log.Logger) error {
+	// when this function is called, m should always be the PT model
+
+	if m.placesMapping != nil && m.transitionsMapping != nil {
+		return nil
+	}
+
+	report := mappingReport{
+		places:      nodesReport{kind: "place"},
+		transitions: nodesReport{kind: "transition"},
+	}
+
+	var placesOrigins, transitionsOrigins map[string][]string
+	filePath := filepath.Join(m.twinModel.directory, globalConfiguration.MappingFile)
+	colHash, ptHash := fileHash(m.twinModel.filePath), fileHash(m.filePath)
+	saved, err := readMappingFile(filePath)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	computed := err != nil || saved.COLHash != "" && (saved.COLHash != colHash || saved.PTHash != ptHash)
+	if computed {
+		if err == nil {
+			logger.Print("Mapping file ", filePath, " is outdated, computing the mapping again")
+		}
+		report.source = "computed"
+		placesDomains, transitionsDomains := colorDomains(m.twinModel.pnml)
+		placesOrigins = report.places.computedOrigins(placesDomains, m.twinModel.places, m.places)
+		transitionsOrigins = report.transitions.computedOrigins(transitionsDomains, m.twinModel.transitions, m.transitions)
+	} else {
+		report.source = "explicit " + filePath
+		if saved.COLHash != "" {
+			report.source = "saved " + filePath
+		}
+		placesOrigins = report.places.explicitOrigins(saved.Places, m.twinModel.places, m.places)
+		transitionsOrigins = report.transitions.explicitOrigins(saved.Transitions, m.twinModel.transitions, m.transitions)
+	}
+
+	var mappedPlaces, mappedTransitions []string
+	m.placesMapping, mappedPlaces, m.twinModel.unmappedPlaces = report.places.build(m.twinModel.places, m.places, placesOrigins)
+	m.transitionsMapping, mappedTransitions, m.twinModel.unmappedTransitions = report.transitions.build(m.twinModel.transitions, m.transitions, transitionsOrigins)
+	m.mappingReport = &report
+	logger.Print("Nodes mapping: ", report.summary())
+
+	// save the computed mapping, for reusing it later and for checking it by hand
+	if computed && writeModelFiles {
+		saved = mappingFile{
+			COLHash:             colHash,
+			PTHash:              ptHash,
+			Places:              restrictMapping(m.placesMapping, mappedPlaces),
+			Transitions:         restrictMapping(m.transitionsMapping, mappedTransitions),
+			UnmappedPlaces:      m.twinModel.unmappedPlaces,
+			UnmappedTransitions: m.twinModel.unmappedTransitions,
+		}
+		if err := saved.write(filePath); err != nil {
+			logger.Print("ERROR: cannot save mapping: ", err)
+		}
+	}
+
+	// check that the sets of nodes of the COL net that were
+	// unfolded into nodes of the PT net are not empty
+	if len(mappedPlaces) == 0 {
+		logger.Print(
+			"Warning, colored model has an empty set of mapped places",
+		)
+		return errors.New("empty set of places")
+	}
+	if len(mappedTransitions) == 0 {
+		logger.Print(
+			"Warning, colored model has an empty set of mapped transitions",
+		)
+		return errors.New("empty set of transitions")
+	}
+	m.twinModel.places = mappedPlaces
+	m.twinModel.transitions = mappedTransitions
+
+	return nil
+}
+
+func readMappingFile(filePath string) (f mappingFile, err error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return f, err
+	}
+	if err := json.Unmarshal(content, &f); err != nil {
+		return f, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return f, nil
+}
+
+func (f mappingFile) write(filePath string) error {
+	content, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, append(content, '\n'), 0644)
+}
+
+// hash of the content of a file, empty if it cannot be read
+func fileHash(filePath string) string {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(content))
+}
+
+// the part of a mapping concerning some nodes only
+func restrictMapping(mapping map[string][]string, nodes []string) map[string][]string {
+	restricted := make(map[string][]string)
+	for _, n := range nodes {
+		restricted[n] = mapping[n]
+	}
+	return restricted
+}
+
+// the COL nodes each PT node may have been unfolded from, according to
+// the ids of the unfolded nodes computed from the color domains of the COL
+// nodes, or to the prefixes of the PT ids when the naming does not follow
+// the color domains
+func (r *nodesReport) computedOrigins(domains map[string][]*colorSort, colNodes, ptNodes []string) map[string][]string {
+	isColNode := make(map[string]bool)
+	for _, n := range colNodes {
+		isColNode[n] = true
+	}
+
+	origins := make(map[string][]string)
+	for _, pt := range ptNodes {
+		structural := make([]string, 0)
+		prefixed := make([]string, 0)
+		for i := len(pt); i > 0; i-- {
+			col := pt[:i]
+			if !isColNode[col] {
+				continue
+			}
+			prefixed = append(prefixed, col)
+			domain, known := domains[col]
+			colors := pt[i:]
+			if known && (colors == "" && len(domain) == 0 ||
+				strings.HasPrefix(colors, "_") && matchColors(colors[1:], domain)) {
+				structural = append(structural, col)
+			}
+		}
+		switch {
+		case len(structural) > 0:
+			origins[pt] = structural
+			if len(structural) == 1 {
+				r.structural++
+			}
+		case len(prefixed) > 0:
+			origins[pt] = prefixed
+			if len(prefixed) == 1 {
+				r.prefix++
+			}
+		}
+	}
+	return origins
+}
+
+// the COL nodes each PT node was unfolded from, according to a mapping file
+func (r *nodesReport) explicitOrigins(mapping map[string][]string, colNodes, ptNodes []string) map[string][]string {
+	isColNode := make(map[string]bool)
+	for _, n := range colNodes {
+		isColNode[n] = true
+	}
+	isPTNode := make(map[string]bool)
+	for _, n := range ptNodes {
+		isPTNode[n] = true
+	}
+
+	origins := make(map[string][]string)
+	for col, pts := range mapping {
+		if !isColNode[col] {
+			r.unknown = append(r.unknown, col)
+			continue
+		}
+		for _, pt := range pts {
+			if !isPTNode[pt] {
+				r.unknown = append(r.unknown, pt)
+				continue
+			}
+			origins[pt] = append(origins[pt], col)
+		}
+	}
+	for _, cols := range origins {
+		sort.Strings(cols)
+		if len(cols) == 1 {
+			r.explicit++
+		}
+	}
+	sort.Strings(r.unknown)
+	return origins
+}
+
+// build the mapping of COL nodes to PT nodes from the origins of PT nodes,
+// COL nodes that are possible origins of ambiguous PT nodes are not mapped
+// as their unfolding is not known for sure
+func (r *nodesReport) build(colNodes, ptNodes []string, origins map[string][]string) (mapping map[string][]string, mapped, unmapped []string) {
+	mapping = make(map[string][]string)
+	r.ambiguous = make(map[string][]string)
+	isAmbiguous := make(map[string]bool)
+	for _, pt := range ptNodes {
+		cols := origins[pt]
+		switch len(cols) {
+		case 0:
+			r.orphanPT = append(r.orphanPT, pt)
+		case 1:
+			mapping[cols[0]] = append(mapping[cols[0]], pt)
+		default:
+			r.ambiguous[pt] = cols
+			for _, col := range cols {
+				isAmbiguous[col] = true
+			}
+		}
+	}
+
+	mapped = make([]string, 0)
+	unmapped = make([]string, 0)
+	for _, col := range colNodes {
+		switch {
+		case isAmbiguous[col]:
+			unmapped = append(unmapped, col)
+		case len(mapping[col]) == 0:
+			r.orphanCOL = append(r.orphanCOL, col)
+			unmapped = append(unmapped, col)
+		default:
+			mapped = append(mapped, col)
+		}
+	}
+	return mapping, mapped, unmapped
+}
+
+// one line description of a mapping
+func (r mappingReport) summary() string {
+	return fmt.Sprint(r.source, ", ", r.places.summary(), ", ", r.transitions.summary())
+}
+
+func (r nodesReport) summary() string {
+	return fmt.Sprint(
+		r.structural+r.prefix+r.explicit, " PT ", r.kind, "s mapped (",
+		r.structural, " structural, ", r.prefix, " by prefix, ", r.explicit, " explicit), ",
+		len(r.ambiguous), " ambiguous, ",
+		len(r.orphanPT), " orphan PT, ",
+		len(r.orphanCOL), " orphan COL, ",
+		len(r.unknown), " unknown",
+	)
+}
+
+// detailed description of the problems of a mapping
+func (r mappingReport) details() []string {
+	return append(r.places.details(), r.transitions.details()...)
+}
+
+func (r nodesReport) details() []string {
+	lines := make([]string, 0)
+	ambiguous := make([]string, 0, len(r.ambiguous))
+	for pt := range r.ambiguous {
+		ambiguous = append(ambiguous, pt)
+	}
+	sort.Strings(ambiguous)
+	for _, pt := range ambiguous {
+		lines = append(lines, fmt.Sprint("ambiguous PT ", r.kind, " ", pt, " could come from ", strings.Join(r.ambiguous[pt], " ")))
+	}
+	for _, pt := range r.orphanPT {
+		lines = append(lines, fmt.Sprint("orphan PT ", r.kind, " ", pt, " not unfolded from a COL ", r.kind))
+	}
+	for _, col := range r.orphanCOL {
+		lines = append(lines, fmt.Sprint("orphan COL ", r.kind, " ", col, " not unfolded to a PT ", r.kind))
+	}
+	for _, id := range r.unknown {
+		lines = append(lines, fmt.Sprint("unknown ", r.kind, " ", id, " in mapping file"))
+	}
+	return lines
+}
@@ -0,0 +1,211 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"io"
+	"log"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// an enumeration sort with colors named after their ids
+func enumerationSort(colors ...string) *colorSort {
+	return &colorSort{kind: "enumeration", constants: colors, names: colors}
+}
+
+func TestComputedOrigins(t *testing.T) {
+	c := enumerationSort("1", "2")
+	d := &colorSort{kind: "enumeration", constants: []string{"d1", "d2"}, names: []string{"left", "right"}}
+	domains := map[string][]*colorSort{
+		"p":   {c, c},
+		"p_1": {c},
+		"q":   {d},
+		"r":   {},
+	}
+	tests := []struct {
+		name       string
+		colNodes   []string
+		ptNode     string
+		origins    []string
+		structural int
+		prefix     int
+	}{
+		{"color ids", []string{"q"}, "q_d1", []string{"q"}, 1, 0},
+		{"color names", []string{"q"}, "q_right", []string{"q"}, 1, 0},
+		{"product", []string{"p"}, "p_2_1", []string{"p"}, 1, 0},
+		{"empty domain", []string{"r"}, "r", []string{"r"}, 1, 0},
+		{"prefix fallback", []string{"q"}, "q_d3", []string{"q"}, 0, 1},
+		{"prefix without domain", []string{"s"}, "s_a", []string{"s"}, 0, 1},
+		{"ambiguous colors", []string{"p", "p_1"}, "p_1_1", []string{"p_1", "p"}, 0, 0},
+		{"colors before prefix", []string{"q", "q_d"}, "q_d1", []string{"q"}, 1, 0},
+		{"ambiguous prefixes", []string{"s", "s_1"}, "s_1_a", []string{"s_1", "s"}, 0, 0},
+		{"no origin", []string{"q"}, "t_d1", nil, 0, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var r nodesReport
+			origins := r.computedOrigins(domains, test.colNodes, []string{test.ptNode})
+			if !reflect.DeepEqual(origins[test.ptNode], test.origins) {
+				t.Errorf("origins %v, expected %v", origins[test.ptNode], test.origins)
+			}
+			if r.structural != test.structural || r.prefix != test.prefix {
+				t.Errorf("%d structural and %d by prefix, expected %d and %d", r.structural, r.prefix, test.structural, test.prefix)
+			}
+		})
+	}
+}
+
+func TestMappingReport(t *testing.T) {
+	c := enumerationSort("1", "2")
+	domains := map[string][]*colorSort{"p": {c, c}, "p_1": {c}, "q": {c}, "u": {c}}
+	colNodes := []string{"p", "p_1", "q", "u"}
+	ptNodes := []string{"p_1_1", "p_2_2", "q_1", "q_2", "q_x", "v_1"}
+
+	r := mappingReport{source: "computed", places: nodesReport{kind: "place"}, transitions: nodesReport{kind: "transition"}}
+	origins := r.places.computedOrigins(domains, colNodes, ptNodes)
+	mapping, mapped, unmapped := r.places.build(colNodes, ptNodes, origins)
+
+	expectedMapping := map[string][]string{"p": {"p_2_2"}, "q": {"q_1", "q_2", "q_x"}}
+	if !reflect.DeepEqual(mapping, expectedMapping) {
+		t.Errorf("mapping %v, expected %v", mapping, expectedMapping)
+	}
+	// p is an origin of the ambiguous p_1_1, its unfolding is not known
+	if !reflect.DeepEqual(mapped, []string{"q"}) || !reflect.DeepEqual(unmapped, []string{"p", "p_1", "u"}) {
+		t.Errorf("mapped %v and unmapped %v", mapped, unmapped)
+	}
+
+	expectedDetails := []string{
+		"ambiguous PT place p_1_1 could come from p_1 p",
+		"orphan PT place v_1 not unfolded from a COL place",
+		"orphan COL place u not unfolded to a PT place",
+	}
+	if details := r.details(); !reflect.DeepEqual(details, expectedDetails) {
+		t.Errorf("details:\n%s\nexpected:\n%s", strings.Join(details, "\n"), strings.Join(expectedDetails, "\n"))
+	}
+	expectedSummary := "computed, " +
+		"4 PT places mapped (3 structural, 1 by prefix, 0 explicit), 1 ambiguous, 1 orphan PT, 1 orphan COL, 0 unknown, " +
+		"0 PT transitions mapped (0 structural, 0 by prefix, 0 explicit), 0 ambiguous, 0 orphan PT, 0 orphan COL, 0 unknown"
+	if summary := r.summary(); summary != expectedSummary {
+		t.Errorf("summary %q, expected %q", summary, expectedSummary)
+	}
+}
+
+func TestExplicitOrigins(t *testing.T) {
+	var r nodesReport
+	origins := r.explicitOrigins(
+		map[string][]string{"p": {"p_a", "p_b"}, "q": {"p_b", "q_z"}, "x": {"x_a"}},
+		[]string{"p", "q"}, []string{"p_a", "p_b"},
+	)
+	expected := map[string][]string{"p_a": {"p"}, "p_b": {"p", "q"}}
+	if !reflect.DeepEqual(origins, expected) {
+		t.Errorf("origins %v, expected %v", origins, expected)
+	}
+	if r.explicit != 1 || !reflect.DeepEqual(r.unknown, []string{"q_z", "x"}) {
+		t.Errorf("%d explicit and unknown %v", r.explicit, r.unknown)
+	}
+}
+
+// the PT twin of the Toy2 COL test model, in a new list of the models of the
+// input directory
+func toy2Model(t *testing.T, inputDir string) *modelInfo {
+	t.Helper()
+	for _, m := range listModels(inputDir) {
+		if m.name() == "Toy2-COL-001" && m.twinModel != nil {
+			return m.twinModel
+		}
+	}
+	t.Fatal("no Toy2-COL-001 model with a twin")
+	return nil
+}
+
+// the computed mapping is saved with the hashes of the pnml files, and reused
+// only as long as they match
+func TestMappingFileReuse(t *testing.T) {
+	setTestConfig(t, nil)
+	inputDir := copyTestModels(t)
+	logger := log.New(io.Discard, "", 0)
+	filePath := filepath.Join(inputDir, "Toy2-COL-001", globalConfiguration.MappingFile)
+
+	m := toy2Model(t, inputDir)
+	m.twinModel.prepare(logger)
+	if m.mappingReport.source != "computed" {
+		t.Fatalf("mapping %s, expected a computed one", m.mappingReport.source)
+	}
+	computed := m.placesMapping
+	saved, err := readMappingFile(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.COLHash == "" || saved.PTHash == "" || !reflect.DeepEqual(saved.Places, computed) {
+		t.Fatalf("saved mapping %+v, expected %v with hashes", saved, computed)
+	}
+
+	// a saved mapping with the hashes of the models is used as is
+	saved.Places = map[string][]string{"p": computed["p"][:1]}
+	if err := saved.write(filePath); err != nil {
+		t.Fatal(err)
+	}
+	m = toy2Model(t, inputDir)
+	m.twinModel.prepare(logger)
+	if !strings.HasPrefix(m.mappingReport.source, "saved") || len(m.placesMapping["p"]) != 1 {
+		t.Errorf("mapping %s %v, expected the saved one", m.mappingReport.source, m.placesMapping)
+	}
+
+	// a stale hash forces recomputation
+	saved.COLHash = "stale"
+	if err := saved.write(filePath); err != nil {
+		t.Fatal(err)
+	}
+	m = toy2Model(t, inputDir)
+	m.twinModel.prepare(logger)
+	if m.mappingReport.source != "computed" || !reflect.DeepEqual(m.placesMapping, computed) {
+		t.Errorf("mapping %s %v, expected %v computed again", m.mappingReport.source, m.placesMapping, computed)
+	}
+	if saved, err := readMappingFile(filePath); err != nil || saved.COLHash == "stale" {
+		t.Errorf("mapping file not updated (%v)", err)
+	}
+}
+
+// models can be prepared without writing files in their directories
+func TestPrepareWithoutWriting(t *testing.T) {
+	setTestConfig(t, nil)
+	defer func() { writeModelFiles = true }()
+	writeModelFiles = false
+	inputDir := copyTestModels(t)
+
+	m := toy2Model(t, inputDir)
+	if !m.twinModel.prepare(log.New(io.Discard, "", 0)) {
+		t.Fatal("cannot unfold")
+	}
+	if len(m.placesMapping) == 0 {
+		t.Error("no mapping computed")
+	}
+	written, err := filepath.Glob(filepath.Join(inputDir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range written {
+		if filepath.Base(path) != "model.pnml" {
+			t.Errorf("%s written", path)
+		}
+	}
+}
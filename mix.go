@@ -0,0 +1,116 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// numbers of formulas of each kind to select, according to the configured
+// mix of verdicts, and numbers of formulas already selected
+type verdictMix struct {
+	hard, decided                          int // formulas to select
+	minTrue, minFalse                      int // decided formulas that must be TRUE (FALSE)
+	numHard, numDecided, numTrue, numFalse int
+}
+
+func newVerdictMix(numFormulas int) verdictMix {
+	hard := int(math.Round(globalConfiguration.UnknownShare * float64(numFormulas)))
+	decided := numFormulas - hard
+	return verdictMix{
+		hard:     hard,
+		decided:  decided,
+		minTrue:  int(globalConfiguration.MinTrueShare * float64(decided)),
+		minFalse: int(globalConfiguration.MinFalseShare * float64(decided)),
+	}
+}
+
+// checks that the configured mix of verdicts is possible
+func checkVerdictMix() error {
+	shares := []float64{globalConfiguration.UnknownShare, globalConfiguration.MinTrueShare, globalConfiguration.MinFalseShare}
+	for _, share := range shares {
+		if share < 0 || share > 1 {
+			return fmt.Errorf("verdict shares must be between 0 and 1, got %v", share)
+		}
+	}
+	if globalConfiguration.MinTrueShare+globalConfiguration.MinFalseShare > 1 {
+		return errors.New("MinTrueShare and MinFalseShare sum to more than 1")
+	}
+	return nil
+}
+
+// checks if a formula can be selected given its filtering, and counts it if so:
+// hard formulas while there are not enough of them, decided formulas while
+// there is room left for the TRUE and FALSE formulas still needed
+func (v *verdictMix) accept(r filterResult) bool {
+	switch r.status {
+	case hard:
+		if v.numHard >= v.hard {
+			return false
+		}
+		v.numHard++
+		return true
+	case decided:
+		numTrue, numFalse := v.numTrue, v.numFalse
+		switch r.verdict {
+		case trueVerdict:
+			numTrue++
+		case falseVerdict:
+			numFalse++
+		}
+		needed := 0
+		if numTrue < v.minTrue {
+			needed += v.minTrue - numTrue
+		}
+		if numFalse < v.minFalse {
+			needed += v.minFalse - numFalse
+		}
+		if v.numDecided+1+needed > v.decided {
+			return false
+		}
+		v.numDecided++
+		v.numTrue, v.numFalse = numTrue, numFalse
+		return true
+	}
+	return false
+}
+
+func (v verdictMix) summary() string {
+	return fmt.Sprint(
+		v.numHard, "/", v.hard, " hard, ",
+		v.numDecided, "/", v.decided, " decided with ",
+		v.numTrue, " TRUE and ", v.numFalse, " FALSE",
+	)
+}
+
+// numbers of formulas of each status
+func filteringSummary(results []filterResult) string {
+	counts := make(map[filterStatus]int)
+	for _, r := range results {
+		counts[r.status]++
+	}
+	return fmt.Sprint(
+		counts[trivial], " trivial, ",
+		counts[decided], " decided, ",
+		counts[hard], " hard, ",
+		counts[skipped], " not checked",
+	)
+}
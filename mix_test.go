@@ -0,0 +1,65 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "testing"
+
+func TestVerdictMixAccept(t *testing.T) {
+	h := filterResult{status: hard, verdict: unknownVerdict}
+	tr := filterResult{status: decided, verdict: trueVerdict}
+	fa := filterResult{status: decided, verdict: falseVerdict}
+	bound := filterResult{status: decided, verdict: boundVerdict, bound: 3}
+	trivialTrue := filterResult{status: trivial, verdict: trueVerdict}
+	notChecked := filterResult{status: skipped, verdict: unknownVerdict}
+	tests := []struct {
+		name                   string
+		numFormulas            int
+		unknown, minTrue, minF float64
+		results                []filterResult
+		accepted               string
+	}{
+		{"only hard", 4, 1, 0, 0, []filterResult{h, tr, h, fa, h, h, h}, "x.x.xx."},
+		{"only decided", 3, 0, 0, 0, []filterResult{h, tr, fa, bound, tr}, ".xxx."},
+		{"never trivial or not checked", 4, 0.5, 0, 0, []filterResult{trivialTrue, notChecked, h, tr}, "..xx"},
+		{"room for FALSE", 4, 0.5, 0.5, 0.5, []filterResult{tr, tr, h, fa, fa}, "x.xx."},
+		{"room for TRUE", 4, 0, 0.5, 0.25, []filterResult{fa, fa, fa, fa, tr, tr}, "xx..xx"},
+		{"bounds count as decided", 4, 0.5, 0.5, 0, []filterResult{bound, bound, tr, h}, "x.xx"},
+		{"rounded shares", 3, 0.5, 0, 0, []filterResult{h, h, h, tr, tr}, "xx.x."},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.UnknownShare = test.unknown
+				c.MinTrueShare = test.minTrue
+				c.MinFalseShare = test.minF
+			})
+			mix := newVerdictMix(test.numFormulas)
+			accepted := make([]byte, len(test.results))
+			for i, r := range test.results {
+				accepted[i] = '.'
+				if mix.accept(r) {
+					accepted[i] = 'x'
+				}
+			}
+			if string(accepted) != test.accepted {
+				t.Errorf("accepted %s, expected %s (%s)", accepted, test.accepted, mix.summary())
+			}
+		})
+	}
+}
@@ -20,7 +20,9 @@ package main
 
 import (
 	"errors"
+	"hash/fnv"
 	"log"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -37,21 +39,26 @@ const (
 )
 
 type modelInfo struct {
-	filePath                string
-	directory               string
-	modelName               string
-	modelType               modelType
-	modelInstance           string
-	modelInstanceSeparators int // HACK: for dealing with models with - in the instance, MCC2021 surprise
-	twinModel               *modelInfo
-	pnml                    *pnml.Pnml
-	places                  []string            // ids of places to use for generation
-	unmappedPlaces          []string            // ids of places that will not be used for generation
-	transitions             []string            // ids of transitions to use for generation
-	unmappedTransitions     []string            // ids of transitions that will not be used for generation
-	placesMapping           map[string][]string // mapping of ids of places to ids of the twin model
-	transitionsMapping      map[string][]string // mapping of ids of transitions
-	maxConstantInMarking    int
+	filePath             string
+	directory            string
+	modelName            string
+	modelType            modelType
+	modelInstance        string
+	twinModel            *modelInfo
+	pnml                 *pnml.Pnml
+	places               []string            // ids of places to use for generation
+	unmappedPlaces       []string            // ids of places that will not be used for generation
+	transitions          []string            // ids of transitions to use for generation
+	unmappedTransitions  []string            // ids of transitions that will not be used for generation
+	excludedPlaces       []string            // ids of mapped places that are constant, not used for generation
+	excludedTransitions  []string            // ids of mapped transitions that can never fire, not used for generation
+	placesMapping        map[string][]string // mapping of ids of places to ids of the twin model (or of the native unfolding for COL models without twin)
+	transitionsMapping   map[string][]string // mapping of ids of transitions
+	unfoldedNet          *petriNet           // native unfolding of COL models without twin
+	net                  *petriNet           // PT net on which formulas are checked, built when first needed
+	mappingReport        *mappingReport      // diagnostic of the mapping of the twin model (PT models only)
+	maxConstantInMarking int
+	rng                  *rand.Rand // random generator used for generating formulas on this model
 	//maxConstantInTransitions int
 }
 
@@ -98,13 +105,12 @@ func listModels(inputDir string) []*modelInfo {
 		// fill the modelInfo for the current model
 		splitName := strings.Split(fileInfo.Name(), "-")
 		instanceName := strings.Join(splitName[2:], "-")
-		separators := len(splitName[2:]) - 1
 		model := modelInfo{
-			filePath:                modelFilePath,
-			directory:               directory,
-			modelName:               splitName[0],
-			modelInstance:           instanceName,
-			modelInstanceSeparators: separators,
+			filePath:      modelFilePath,
+			directory:     directory,
+			modelName:     splitName[0],
+			modelInstance: instanceName,
+			rng:           newModelRand(globalConfiguration.Seed, fileInfo.Name()),
 		}
 		if splitName[1] == "COL" {
 			model.modelType = col
@@ -157,6 +163,125 @@ func listModels(inputDir string) []*modelInfo {
 	return models
 }
 
+// name of a model, as given by the name of its directory
+func (m modelInfo) name() string {
+	kind := "COL"
+	if m.modelType != col {
+		kind = "PT"
+	}
+	return m.modelName + "-" + kind + "-" + m.modelInstance
+}
+
+// random generator for a model, it depends only on the configured seed and on
+// the name of the model, so that generation does not depend on the order in
+// which models are handled
+func newModelRand(seed int64, name string) *rand.Rand {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return rand.New(rand.NewSource(seed ^ int64(h.Sum64())))
+}
+
+// copy of a model (and of its twin) for generating the formulas of an
+// examination, with the random generator of the examination and its own lists
+// of nodes (that generation shuffles), so that examinations can be generated
+// concurrently and do not depend on each other
+func (m *modelInfo) forExamination(e examination) *modelInfo {
+	em := m.copyForExamination(e)
+	if m.twinModel != nil {
+		twin := m.twinModel.copyForExamination(e)
+		em.twinModel, twin.twinModel = twin, em
+	}
+	return em
+}
+
+func (m *modelInfo) copyForExamination(e examination) *modelInfo {
+	c := *m
+	c.places = append([]string(nil), m.places...)
+	c.transitions = append([]string(nil), m.transitions...)
+	c.rng = e.rand(m)
+	return &c
+}
+
+// whether preparing models writes the computed mapping and the report of
+// the structural analysis next to them, the commands that only show
+// information about models turn it off
+var writeModelFiles = true
+
+// parse a model and its twin, get their nodes and map them
+// returns false if the formulas of the model cannot be unfolded to its twin
+func (m *modelInfo) prepare(logger *log.Logger) (canUnfold bool) {
+	var error error
+	m.getpnml(logger)
+	m.getids(logger)
+	m.getMaxConstants(logger)
+	if m.twinModel != nil {
+		m.twinModel.getpnml(logger)
+		m.twinModel.getids(logger)
+		m.twinModel.getMaxConstants(logger)
+		error = m.twinModel.mapids(logger)
+	} else if m.modelType == col {
+		error = m.unfold(logger)
+	}
+
+	canUnfold = true
+	if error != nil {
+		logger.Print("Warning: will not unfold formulas: ", error)
+		canUnfold = false
+	}
+
+	m.excludeTrivialNodes(logger)
+	return canUnfold
+}
+
+// unfold a COL model without twin, for filtering its formulas
+func (m *modelInfo) unfold(logger *log.Logger) error {
+	if m.unfoldedNet != nil {
+		return nil
+	}
+	net, placesMapping, transitionsMapping, err := unfoldColoredNet(m.pnml)
+	if err != nil {
+		return err
+	}
+	m.unfoldedNet = net
+	m.placesMapping = placesMapping
+	m.transitionsMapping = transitionsMapping
+	logger.Print(
+		"COL model unfolded to ",
+		len(net.places), " places and ",
+		len(net.transitions), " transitions.",
+	)
+	return nil
+}
+
+// the model holding the mapping used for unfolding the formulas of a COL
+// model: its PT twin, or the model itself when it was unfolded natively
+func (m *modelInfo) unfoldingModel() *modelInfo {
+	if m.twinModel != nil {
+		return m.twinModel
+	}
+	return m
+}
+
+// the PT net on which the formulas of a model are checked (once unfolded
+// for COL models)
+func (m *modelInfo) ptNet() (net *petriNet, err error) {
+	if m.net != nil {
+		return m.net, nil
+	}
+	switch {
+	case m.modelType != col:
+		net, err = newPetriNet(m.pnml)
+	case m.twinModel != nil:
+		net, err = newPetriNet(m.twinModel.pnml)
+	case m.unfoldedNet != nil:
+		net = m.unfoldedNet
+	default:
+		err = errors.New("COL model not unfolded")
+	}
+	m.net = net
+	return net, err
+}
+
 func (m *modelInfo) getpnml(logger *log.Logger) {
 	if m.pnml == nil {
 		m.pnml = pnml.GetPnml(m.filePath, false)
@@ -185,122 +310,3 @@ func (m *modelInfo) getMaxConstants(logger *log.Logger) {
 		"maximum constant appearing in marking: ", m.maxConstantInMarking,
 	)
 }
-
-// checks if a place/transition of a PT model was unfolded from a place/transition
-// of the twin COL model
-func isUnfolding(ptNode, colNode string, colNodes []string, logger *log.Logger) bool {
-	if strings.HasPrefix(ptNode, colNode) {
-		logger.Print("Nodes mapping info: ", ptNode, " could have been obtained from ", colNode)
-		if ptNode == colNode {
-			logger.Print("Nodes mapping info: yes, it was (equality)")
-			return true
-		}
-		for _, n := range colNodes {
-			if ptNode == n {
-				logger.Print("Nodes mapping info: no, it was not, ", n, " exists in COL")
-				return false
-			}
-		}
-		logger.Print("Nodes mapping info: yes, it was (prefix)")
-		return true
-	}
-	return false
-}
-
-func (m *modelInfo) mapids(logger *log.Logger) error {
-	// when this function is called, m should always be the PT model
-
-	if m.placesMapping == nil || m.transitionsMapping == nil {
-
-		m.placesMapping = make(map[string][]string)
-		m.transitionsMapping = make(map[string][]string)
-
-		checkPlaces := make([]bool, len(m.places))
-		unmappedPlaces := make([]string, 0)
-		mappedPlaces := make([]string, 0)
-		for _, p := range m.twinModel.places {
-			// will not work if a place of the COL model has an id which is a prefix of another place id of this model
-			for i, pp := range m.places {
-				if isUnfolding(pp, p, m.twinModel.places, logger) {
-					m.placesMapping[p] = append(m.placesMapping[p], pp)
-					checkPlaces[i] = true
-					logger.Print("Place mapping: ", p, "->", pp)
-				}
-			}
-			// check that p was unfolded into something
-			if len(m.placesMapping[p]) == 0 {
-				logger.Print(
-					"Warning, colored model has a place not mapped to a PT place: ",
-					p,
-				)
-				unmappedPlaces = append(unmappedPlaces, p)
-			} else {
-				mappedPlaces = append(mappedPlaces, p)
-			}
-		}
-		// check that every PT place is the unfolding of something
-		for i, v := range checkPlaces {
-			if !v {
-				logger.Print(
-					"Warning, PT model has a place not unfolded from a COL place: ",
-					m.places[i],
-				)
-			}
-		}
-		// check that the set of places of the COL net that were
-		// unfolded into places of the PT net is not empty
-		if len(mappedPlaces) == 0 {
-			logger.Print(
-				"Warning, colored model has an empty set of mapped places",
-			)
-			return errors.New("empty set of places")
-		}
-		m.twinModel.places = mappedPlaces
-		m.twinModel.unmappedPlaces = unmappedPlaces
-
-		checkTransitions := make([]bool, len(m.transitions))
-		unmappedTransitions := make([]string, 0)
-		mappedTransitions := make([]string, 0)
-		for _, t := range m.twinModel.transitions {
-			// will not work if a transition of the COL model has an id which is a prefix of another transition id of this model
-			for i, tt := range m.transitions {
-				if isUnfolding(tt, t, m.twinModel.transitions, logger) {
-					m.transitionsMapping[t] = append(m.transitionsMapping[t], tt)
-					checkTransitions[i] = true
-					logger.Print("Transition mapping: ", t, "->", tt)
-				}
-			}
-			// check that t was unfolded into something
-			if len(m.transitionsMapping[t]) == 0 {
-				logger.Print(
-					"Warning, colored model has a transition not mapped to a PT transition: ",
-					t,
-				)
-				unmappedTransitions = append(unmappedTransitions, t)
-			} else {
-				mappedTransitions = append(mappedTransitions, t)
-			}
-		}
-		// check that every PT transition is the unfolding of something
-		for i, v := range checkTransitions {
-			if !v {
-				logger.Print(
-					"Warning, PT model has a transition not unfolded from a COL transition: ",
-					m.transitions[i],
-				)
-			}
-		}
-		// check that the set of transitions of the COL net that were
-		// unfolded into transitions of the PT net is not empty
-		if len(mappedTransitions) == 0 {
-			logger.Print(
-				"Warning, colored model has an empty set of mapped transitions",
-			)
-			return errors.New("empty set of transitions")
-		}
-		m.twinModel.transitions = mappedTransitions
-		m.twinModel.unmappedTransitions = unmappedTransitions
-	}
-
-	return nil
-}
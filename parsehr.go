@@ -0,0 +1,318 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// parser for the human-readable format produced by hrPrint and ashr
+//
+// properties:
+//
+//	Property <id> "<description>" is: <formula> end.
+//
+// formulas, from the lowest to the highest priority:
+//
+//	<formula> | <formula> | ...
+//	<formula> & <formula> & ...
+//	<formula> U <formula>
+//	! <formula>, A <formula>, E <formula>, G <formula>, F <formula>, X <formula>
+//	( <formula> ), is-fireable("t", ...), place-bound("p", ...), <int> <= <int>
+//
+// integers:
+//
+//	tokens-count("p", ...), <constant>
+type hrParser struct {
+	filePath string
+	input    string
+	pos      int
+}
+
+// read a set of formulas from a file in the human-readable format
+func readhrFormulas(filePath string) ([]property, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	p := hrParser{filePath: filePath, input: string(content)}
+	properties := make([]property, 0)
+	for p.skipSpaces(); p.pos < len(p.input); p.skipSpaces() {
+		prop, err := p.property()
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, prop)
+	}
+
+	return properties, nil
+}
+
+// read one formula in the human-readable format
+func parsehrFormula(s string) (formula, error) {
+	p := hrParser{filePath: "formula", input: s}
+	f, err := p.formula()
+	if err != nil {
+		return f, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return f, p.errorf("unexpected %q after formula", p.input[p.pos:])
+	}
+	return f, nil
+}
+
+func (p *hrParser) errorf(format string, a ...interface{}) error {
+	line, col := newPositionTracker([]byte(p.input)).at(int64(p.pos))
+	msg := fmt.Sprintf(format, a...)
+	return errors.New(fmt.Sprint(p.filePath, " at line ", line, ", col ", col, ", ", msg))
+}
+
+func (p *hrParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// checks if the next symbol is s, and consumes it if so
+func (p *hrParser) accept(s string) bool {
+	p.skipSpaces()
+	if !strings.HasPrefix(p.input[p.pos:], s) {
+		return false
+	}
+	// keywords must not be followed by a letter (A vs. AB)
+	end := p.pos + len(s)
+	if isWordChar(s[len(s)-1]) && end < len(p.input) && isWordChar(p.input[end]) {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+func (p *hrParser) expect(s string) error {
+	if !p.accept(s) {
+		return p.errorf("expected %q", s)
+	}
+	return nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '-' || c == '_' || c < 128 && (unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c)))
+}
+
+// a run of letters, digits, - and _
+func (p *hrParser) word() string {
+	p.skipSpaces()
+	start := p.pos
+	for p.pos < len(p.input) && isWordChar(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+// a string between double quotes
+func (p *hrParser) quoted() (string, error) {
+	if err := p.expect("\""); err != nil {
+		return "", err
+	}
+	end := strings.IndexByte(p.input[p.pos:], '"')
+	if end < 0 {
+		return "", p.errorf("unterminated string")
+	}
+	s := p.input[p.pos : p.pos+end]
+	p.pos += end + 1
+	return s, nil
+}
+
+func (p *hrParser) property() (prop property, err error) {
+	if err = p.expect("Property"); err != nil {
+		return prop, err
+	}
+	p.skipSpaces()
+	end := strings.IndexFunc(p.input[p.pos:], unicode.IsSpace)
+	if end <= 0 {
+		return prop, p.errorf("expected a property id")
+	}
+	prop.id = p.input[p.pos : p.pos+end]
+	p.pos += end
+	if prop.description, err = p.quoted(); err != nil {
+		return prop, err
+	}
+	if err = p.expect("is"); err != nil {
+		return prop, err
+	}
+	if err = p.expect(":"); err != nil {
+		return prop, err
+	}
+	if prop.formula, err = p.formula(); err != nil {
+		return prop, err
+	}
+	if err = p.expect("end"); err != nil {
+		return prop, err
+	}
+	err = p.expect(".")
+	return prop, err
+}
+
+func (p *hrParser) formula() (formula, error) {
+	return p.nary("|", orOperator, p.conjunction)
+}
+
+func (p *hrParser) conjunction() (formula, error) {
+	return p.nary("&", andOperator, p.until)
+}
+
+// operands separated by symbol, combined with op if there are at least two of them
+func (p *hrParser) nary(symbol string, op operator, operand func() (formula, error)) (f formula, err error) {
+	first, err := operand()
+	if err != nil {
+		return f, err
+	}
+	operands := []formula{first}
+	for p.accept(symbol) {
+		next, err := operand()
+		if err != nil {
+			return f, err
+		}
+		operands = append(operands, next)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	op.maxArity = len(operands)
+	return formula{operator: op, operand: operands}, nil
+}
+
+func (p *hrParser) until() (f formula, err error) {
+	before, err := p.unary()
+	if err != nil {
+		return f, err
+	}
+	if !p.accept("U") {
+		return before, nil
+	}
+	reach, err := p.unary()
+	if err != nil {
+		return f, err
+	}
+	return formula{operator: untilOperator, operand: []formula{before, reach}}, nil
+}
+
+// prefix operators of the human-readable format
+type hrPrefix struct {
+	symbol   string
+	operator operator
+}
+
+var hrUnaryOperators []hrPrefix = []hrPrefix{
+	{"!", notOperator},
+	{"A", allPathsOperator},
+	{"E", existsPathOperator},
+	{"G", globallyOperator},
+	{"F", finallyOperator},
+	{"X", nextOperator},
+}
+
+func (p *hrParser) unary() (f formula, err error) {
+	for _, u := range hrUnaryOperators {
+		if p.accept(u.symbol) {
+			operand, err := p.unary()
+			if err != nil {
+				return f, err
+			}
+			return formula{operator: u.operator, operand: []formula{operand}}, nil
+		}
+	}
+	return p.primary()
+}
+
+func (p *hrParser) primary() (f formula, err error) {
+	if p.accept("(") {
+		if f, err = p.formula(); err != nil {
+			return f, err
+		}
+		return f, p.expect(")")
+	}
+	if p.accept("is-fireable") {
+		f.operator = isfireable
+		f.operand, err = p.nodes()
+		return f, err
+	}
+	if p.accept("place-bound") {
+		f.operator = placebound
+		f.operand, err = p.nodes()
+		return f, err
+	}
+
+	// integer comparison
+	left, err := p.integer()
+	if err != nil {
+		return f, err
+	}
+	if err = p.expect("<="); err != nil {
+		return f, err
+	}
+	right, err := p.integer()
+	if err != nil {
+		return f, err
+	}
+	return formula{operator: leqOperator, operand: []formula{left, right}}, nil
+}
+
+func (p *hrParser) integer() (f formula, err error) {
+	if p.accept("tokens-count") {
+		f.operator = tokencount
+		f.operand, err = p.nodes()
+		return f, err
+	}
+	start := p.pos
+	value := p.word()
+	if value == "" || strings.IndexFunc(value, func(r rune) bool { return !unicode.IsDigit(r) }) >= 0 {
+		p.pos = start
+		p.skipSpaces()
+		return f, p.errorf("expected a formula")
+	}
+	f.operator = integerconstant
+	f.operand = []formula{{operator: operator{name: value}}}
+	return f, nil
+}
+
+// a list of quoted places or transitions ids between parentheses
+func (p *hrParser) nodes() ([]formula, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	nodes := make([]formula, 0)
+	for {
+		id, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, formula{operator: operator{name: id}})
+		if !p.accept(",") {
+			break
+		}
+	}
+	return nodes, p.expect(")")
+}
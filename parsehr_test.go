@@ -0,0 +1,138 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+// formulas in the human-readable format, covering all the operators
+var roundTripFormulas []string = []string{
+	`A (G (is-fireable("t0")))`,
+	`E (F (is-fireable("t0", "t1")))`,
+	`A (X (! (tokens-count("p0") <= 3)))`,
+	`E ((is-fireable("t0")) U (tokens-count("p0", "p1") <= 2))`,
+	`A (G (E (F ((is-fireable("t0")) & (2 <= tokens-count("p1"))))))`,
+	`(is-fireable("t0")) | (is-fireable("t1")) | (! (is-fireable("t2")))`,
+	`A (F (G ((tokens-count("p0") <= tokens-count("p1")) & (X (is-fireable("t0"))))))`,
+	`place-bound("p0", "p1")`,
+	`tokens-count("p_0-a") <= 10`,
+}
+
+func mustParse(t *testing.T, s string) formula {
+	t.Helper()
+	f, err := parsehrFormula(s)
+	if err != nil {
+		t.Fatalf("cannot parse %q: %v", s, err)
+	}
+	return f
+}
+
+func TestParsehrRoundTrip(t *testing.T) {
+	for _, s := range roundTripFormulas {
+		f := mustParse(t, s)
+		if f.ashr() != s {
+			t.Errorf("%s printed as %s", s, f.ashr())
+		}
+		g, err := parsehrFormula(f.ashr())
+		if err != nil {
+			t.Errorf("cannot parse back %s: %v", f.ashr(), err)
+			continue
+		}
+		if !g.equals(f) {
+			t.Errorf("%s parsed back as %s", f.ashr(), g.ashr())
+		}
+	}
+}
+
+func TestParsehrPriorities(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`A G is-fireable("t0")`, `A (G (is-fireable("t0")))`},
+		{`is-fireable("t0") & is-fireable("t1") | is-fireable("t2")`, `((is-fireable("t0")) & (is-fireable("t1"))) | (is-fireable("t2"))`},
+		{`! is-fireable("t0") U is-fireable("t1") & is-fireable("t2")`, `((! (is-fireable("t0"))) U (is-fireable("t1"))) & (is-fireable("t2"))`},
+		{`E F 1 <= tokens-count("p0")`, `E (F (1 <= tokens-count("p0")))`},
+	}
+	for _, test := range tests {
+		if f := mustParse(t, test.input); f.ashr() != test.expected {
+			t.Errorf("%s parsed as %s, expected %s", test.input, f.ashr(), test.expected)
+		}
+	}
+}
+
+func TestParsehrErrors(t *testing.T) {
+	for _, s := range []string{
+		``,
+		`A (G (is-fireable("t0"))`,
+		`is-fireable("t0`,
+		`is-fireable()`,
+		`tokens-count("p0") <=`,
+		`AG is-fireable("t0")`,
+		`is-fireable("t0") extra`,
+	} {
+		if f, err := parsehrFormula(s); err == nil {
+			t.Errorf("%q parsed as %s, expected an error", s, f.ashr())
+		}
+	}
+}
+
+func TestReadhrRoundTrip(t *testing.T) {
+	properties := roundTripProperties(t)
+	filePath := filepath.Join(t.TempDir(), "formulas.txt")
+	writehrProperties(properties, filePath, log.New(io.Discard, "", 0))
+
+	read, err := readhrFormulas(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkProperties(t, read, properties)
+}
+
+func roundTripProperties(t *testing.T) []property {
+	properties := make([]property, len(roundTripFormulas))
+	for i, s := range roundTripFormulas {
+		properties[i] = property{
+			id:          fmt.Sprintf("Model-PT-001-CTLFireability-%2.2d", i),
+			description: "Automatically generated",
+			formula:     mustParse(t, s),
+		}
+	}
+	return properties
+}
+
+func checkProperties(t *testing.T, read, expected []property) {
+	t.Helper()
+	if len(read) != len(expected) {
+		t.Fatalf("%d properties read, expected %d", len(read), len(expected))
+	}
+	for i, p := range read {
+		if p.id != expected[i].id || p.description != expected[i].description {
+			t.Errorf("property %q %q, expected %q %q", p.id, p.description, expected[i].id, expected[i].description)
+		}
+		if !p.formula.equals(expected[i].formula) {
+			t.Errorf("formula %s read as %s", expected[i].formula.ashr(), p.formula.ashr())
+		}
+	}
+}
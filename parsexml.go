@@ -0,0 +1,275 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// a formula together with the information attached to it in a property file
+type property struct {
+	id          string
+	description string
+	formula     formula
+}
+
+// an element of an xml file, with its position in the file
+type xmlNode struct {
+	name     string
+	text     string
+	children []*xmlNode
+	line     int
+	col      int
+}
+
+// read a set of formulas from a file in the MCC property-set xml format
+func readxmlFormulas(filePath string) ([]property, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	root, err := parsexmlTree(content, filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if root.name != "property-set" {
+		return nil, root.errorf(filePath, "expected <property-set>, found <%s>", root.name)
+	}
+
+	properties := make([]property, 0, len(root.children))
+	for _, n := range root.children {
+		if n.name != "property" {
+			return nil, n.errorf(filePath, "unknown element <%s> in <property-set>", n.name)
+		}
+		p, err := n.asProperty(filePath)
+		if err != nil {
+			return nil, err
+		}
+		properties = append(properties, p)
+	}
+
+	return properties, nil
+}
+
+// build the tree of elements of an xml file
+func parsexmlTree(content []byte, filePath string) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	stack := make([]*xmlNode, 0)
+	var root *xmlNode
+	positions := newPositionTracker(content)
+	for {
+		offset := decoder.InputOffset()
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			n := &xmlNode{name: t.Name.Local}
+			n.line, n.col = positions.at(offset)
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, n)
+			} else if root == nil {
+				root = n
+			} else {
+				return nil, n.errorf(filePath, "element <%s> after the root element <%s>", n.name, root.name)
+			}
+			stack = append(stack, n)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+	if root == nil {
+		return nil, errors.New(fmt.Sprint(filePath, ": no xml element found"))
+	}
+	return root, nil
+}
+
+// line and column of offsets in a file, computed incrementally as the
+// offsets given by the decoder only increase
+type positionTracker struct {
+	content   []byte
+	offset    int64
+	line, col int
+}
+
+func newPositionTracker(content []byte) *positionTracker {
+	return &positionTracker{content: content, line: 1, col: 1}
+}
+
+// line and column corresponding to an offset, not before the previous one
+func (p *positionTracker) at(offset int64) (line, col int) {
+	for ; p.offset < offset; p.offset++ {
+		if p.content[p.offset] == '\n' {
+			p.line++
+			p.col = 1
+		} else {
+			p.col++
+		}
+	}
+	return p.line, p.col
+}
+
+func (n *xmlNode) errorf(filePath string, format string, a ...interface{}) error {
+	msg := fmt.Sprintf(format, a...)
+	return errors.New(fmt.Sprint(filePath, " at line ", n.line, ", col ", n.col, ", ", msg))
+}
+
+func (n *xmlNode) asProperty(filePath string) (p property, err error) {
+	foundFormula := false
+	for _, c := range n.children {
+		switch c.name {
+		case "id":
+			p.id = strings.TrimSpace(c.text)
+		case "description":
+			p.description = strings.TrimSpace(c.text)
+		case "formula":
+			if len(c.children) != 1 {
+				return p, c.errorf(filePath, "<formula> with %d elements (should be 1)", len(c.children))
+			}
+			p.formula, err = c.children[0].asFormula(filePath)
+			if err != nil {
+				return p, err
+			}
+			foundFormula = true
+		default:
+			return p, c.errorf(filePath, "unknown element <%s> in <property>", c.name)
+		}
+	}
+	if p.id == "" {
+		return p, n.errorf(filePath, "property without id")
+	}
+	if !foundFormula {
+		return p, n.errorf(filePath, "property %s without formula", p.id)
+	}
+	return p, nil
+}
+
+// xml elements with formulas as children and the corresponding operators
+var xmlOperators map[string]operator = map[string]operator{
+	"all-paths":   allPathsOperator,
+	"exists-path": existsPathOperator,
+	"negation":    notOperator,
+	"conjunction": andOperator,
+	"disjunction": orOperator,
+	"globally":    globallyOperator,
+	"finally":     finallyOperator,
+	"next":        nextOperator,
+	"integer-le":  leqOperator,
+}
+
+func (n *xmlNode) asFormula(filePath string) (f formula, err error) {
+	switch n.name {
+	case "until":
+		f.operator = untilOperator
+		f.operand = make([]formula, 2)
+		if len(n.children) != 2 || n.children[0].name != "before" || n.children[1].name != "reach" {
+			return f, n.errorf(filePath, "<until> should contain exactly <before> and <reach>")
+		}
+		for i, c := range n.children {
+			if len(c.children) != 1 {
+				return f, c.errorf(filePath, "<%s> with %d elements (should be 1)", c.name, len(c.children))
+			}
+			f.operand[i], err = c.children[0].asFormula(filePath)
+			if err != nil {
+				return f, err
+			}
+		}
+		return f, nil
+	case "is-fireable":
+		f.operator = isfireable
+		f.operand, err = n.asNodes(filePath, "transition")
+		return f, err
+	case "tokens-count":
+		f.operator = tokencount
+		f.operand, err = n.asNodes(filePath, "place")
+		return f, err
+	case "place-bound":
+		f.operator = placebound
+		f.operand, err = n.asNodes(filePath, "place")
+		return f, err
+	case "integer-constant":
+		value := strings.TrimSpace(n.text)
+		if _, err := strconv.Atoi(value); err != nil {
+			return f, n.errorf(filePath, "<integer-constant> with non integer value %q", value)
+		}
+		if len(n.children) != 0 {
+			return f, n.errorf(filePath, "<integer-constant> should not contain elements")
+		}
+		f.operator = integerconstant
+		f.operand = []formula{{operator: operator{name: value}}}
+		return f, nil
+	}
+
+	op, known := xmlOperators[n.name]
+	if !known {
+		return f, n.errorf(filePath, "unknown element <%s>", n.name)
+	}
+	if op.maxArity == 0 {
+		op.maxArity = len(n.children)
+	}
+	if len(n.children) < op.minArity || len(n.children) > op.maxArity {
+		return f, n.errorf(filePath, "<%s> with %d elements (should be between %d and %d)", n.name, len(n.children), op.minArity, op.maxArity)
+	}
+	f.operator = op
+	f.operand = make([]formula, len(n.children))
+	for i, c := range n.children {
+		f.operand[i], err = c.asFormula(filePath)
+		if err != nil {
+			return f, err
+		}
+	}
+	return f, nil
+}
+
+// places or transitions listed in an atom
+func (n *xmlNode) asNodes(filePath string, kind string) ([]formula, error) {
+	if len(n.children) == 0 {
+		return nil, n.errorf(filePath, "<%s> without <%s>", n.name, kind)
+	}
+	nodes := make([]formula, len(n.children))
+	for i, c := range n.children {
+		if c.name != kind {
+			return nil, c.errorf(filePath, "unknown element <%s> in <%s> (expected <%s>)", c.name, n.name, kind)
+		}
+		id := strings.TrimSpace(c.text)
+		if id == "" {
+			return nil, c.errorf(filePath, "empty <%s>", kind)
+		}
+		nodes[i] = formula{operator: operator{name: id}}
+	}
+	return nodes, nil
+}
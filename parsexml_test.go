@@ -0,0 +1,83 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadxmlRoundTrip(t *testing.T) {
+	properties := roundTripProperties(t)
+	filePath := filepath.Join(t.TempDir(), "formulas.xml")
+	writexmlProperties(properties, filePath, log.New(io.Discard, "", 0))
+
+	read, err := readxmlFormulas(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkProperties(t, read, properties)
+}
+
+func TestReadxmlErrors(t *testing.T) {
+	property := `<property><id>p</id><description>d</description><formula>%s</formula></property>`
+	tests := []struct {
+		name    string
+		content string
+		message string
+	}{
+		{"not xml", `<property-set>`, "line 1"},
+		{"unknown element", `<property-set>` + strings.Replace(property, "%s", `<always/>`, 1) + `</property-set>`, "always"},
+		{"second root", `<property-set></property-set><property-set></property-set>`, "after the root element"},
+		{"missing transition", `<property-set>` + strings.Replace(property, "%s", `<is-fireable/>`, 1) + `</property-set>`, "line 1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "formulas.xml")
+			if err := os.WriteFile(filePath, []byte(test.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			_, err := readxmlFormulas(filePath)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Errorf("error %q does not mention %q", err, test.message)
+			}
+		})
+	}
+}
+
+func TestPositionTracker(t *testing.T) {
+	p := newPositionTracker([]byte("ab\ncd\n\nef"))
+	for _, test := range []struct {
+		offset    int64
+		line, col int
+	}{
+		{0, 1, 1}, {1, 1, 2}, {3, 2, 1}, {4, 2, 2}, {7, 4, 1}, {8, 4, 2},
+	} {
+		if line, col := p.at(test.offset); line != test.line || col != test.col {
+			t.Errorf("offset %d at %d:%d, expected %d:%d", test.offset, line, col, test.line, test.col)
+		}
+	}
+}
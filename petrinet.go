@@ -0,0 +1,200 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/loig/pinimili/pnml"
+)
+
+const ptNetType string = "http://www.pnml.org/version-2009/grammar/ptnet"
+
+// a place/transition net, as used by the model checker
+type petriNet struct {
+	places          []string
+	transitions     []string
+	placeIndex      map[string]int
+	transitionIndex map[string]int
+	pre             [][]arcWeight // input places of each transition
+	post            [][]arcWeight // output places of each transition
+	initialMarking  marking
+}
+
+type arcWeight struct {
+	place  int
+	weight int
+}
+
+type marking []int
+
+// all the pages of a parsed model, including nested ones
+func allPages(p *pnml.Pnml) []pnml.Page {
+	pages := make([]pnml.Page, 0)
+	for _, n := range p.Nets {
+		pages = append(pages, n.Pages...)
+	}
+	for i := 0; i < len(pages); i++ {
+		pages = append(pages, pages[i].Pages...)
+	}
+	return pages
+}
+
+// reference nodes point to places and transitions of other pages, the
+// resolver gives the id of the node a reference points to
+func referenceResolver(pages []pnml.Page) func(string) string {
+	references := make(map[string]string)
+	for _, pa := range pages {
+		for _, rp := range pa.RefPlaces {
+			references[*rp.ID] = *rp.Reference
+		}
+		for _, rt := range pa.RefTransitions {
+			references[*rt.ID] = *rt.Reference
+		}
+	}
+	return func(id string) string {
+		for i := 0; i <= len(references); i++ {
+			ref, isRef := references[id]
+			if !isRef {
+				return id
+			}
+			id = ref
+		}
+		return id
+	}
+}
+
+// build a petriNet from a parsed PT model
+func newPetriNet(p *pnml.Pnml) (*petriNet, error) {
+	net := petriNet{
+		placeIndex:      make(map[string]int),
+		transitionIndex: make(map[string]int),
+	}
+
+	for _, n := range p.Nets {
+		if n.Type == nil || *n.Type != ptNetType {
+			return nil, errors.New("not a PT net")
+		}
+	}
+	pages := allPages(p)
+
+	// places and transitions
+	for _, pa := range pages {
+		for _, pl := range pa.Places {
+			if _, exists := net.placeIndex[*pl.ID]; exists {
+				return nil, fmt.Errorf("duplicate place %s", *pl.ID)
+			}
+			net.placeIndex[*pl.ID] = len(net.places)
+			net.places = append(net.places, *pl.ID)
+			tokens := 0
+			if pl.InitialMarking != nil && pl.InitialMarking.Tokens != nil {
+				tokens = int(*pl.InitialMarking.Tokens)
+			}
+			net.initialMarking = append(net.initialMarking, tokens)
+		}
+		for _, tr := range pa.Transitions {
+			if _, exists := net.transitionIndex[*tr.ID]; exists {
+				return nil, fmt.Errorf("duplicate transition %s", *tr.ID)
+			}
+			net.transitionIndex[*tr.ID] = len(net.transitions)
+			net.transitions = append(net.transitions, *tr.ID)
+		}
+	}
+
+	resolve := referenceResolver(pages)
+
+	// arcs
+	net.pre = make([][]arcWeight, len(net.transitions))
+	net.post = make([][]arcWeight, len(net.transitions))
+	for _, pa := range pages {
+		for _, a := range pa.Arcs {
+			weight := 1
+			if a.Weight != nil && a.Weight.Value != nil {
+				weight = int(*a.Weight.Value)
+			}
+			source := resolve(*a.Source)
+			target := resolve(*a.Target)
+			if p, isPlace := net.placeIndex[source]; isPlace {
+				t, isTransition := net.transitionIndex[target]
+				if !isTransition {
+					return nil, fmt.Errorf("arc %s has unknown target %s", *a.ID, target)
+				}
+				net.pre[t] = addArc(net.pre[t], p, weight)
+				continue
+			}
+			if t, isTransition := net.transitionIndex[source]; isTransition {
+				p, isPlace := net.placeIndex[target]
+				if !isPlace {
+					return nil, fmt.Errorf("arc %s has unknown target %s", *a.ID, target)
+				}
+				net.post[t] = addArc(net.post[t], p, weight)
+				continue
+			}
+			return nil, fmt.Errorf("arc %s has unknown source %s", *a.ID, source)
+		}
+	}
+
+	return &net, nil
+}
+
+// add an arc to a list of arcs, merging it with an existing arc on the same place
+func addArc(arcs []arcWeight, place, weight int) []arcWeight {
+	for i := range arcs {
+		if arcs[i].place == place {
+			arcs[i].weight += weight
+			return arcs
+		}
+	}
+	return append(arcs, arcWeight{place: place, weight: weight})
+}
+
+// checks if transition t is enabled in marking m
+func (net *petriNet) isEnabled(m marking, t int) bool {
+	for _, a := range net.pre[t] {
+		if m[a.place] < a.weight {
+			return false
+		}
+	}
+	return true
+}
+
+// fire transition t from marking m (t is supposed to be enabled)
+func (net *petriNet) fire(m marking, t int) marking {
+	next := make(marking, len(m))
+	copy(next, m)
+	for _, a := range net.pre[t] {
+		next[a.place] -= a.weight
+	}
+	for _, a := range net.post[t] {
+		next[a.place] += a.weight
+	}
+	return next
+}
+
+// compact representation of a marking, usable as a map key
+func (m marking) key() string {
+	buf := make([]byte, len(m)*binary.MaxVarintLen64)
+	n := 0
+	for _, v := range m {
+		n += binary.PutUvarint(buf[n:], uint64(v))
+	}
+	return string(buf[:n])
+}
@@ -0,0 +1,74 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "sync"
+
+// pool of workers shared by all the models, so that the cores left idle by
+// the models that are done are used by the other ones
+type workerPool struct {
+	slots chan struct{}
+}
+
+// workers for the preparation of models and the filtering of formulas, nil
+// when jobs are run directly
+var workers *workerPool
+
+func newWorkerPool(size int) *workerPool {
+	if size < 1 {
+		size = 1
+	}
+	return &workerPool{slots: make(chan struct{}, size)}
+}
+
+// run a job once a worker is free (directly on a nil pool)
+func (p *workerPool) run(job func()) {
+	if p == nil {
+		job()
+		return
+	}
+	p.slots <- struct{}{}
+	defer func() { <-p.slots }()
+	job()
+}
+
+// run jobs concurrently, through a pool of workers (or without limit on a
+// nil pool), and wait for all of them, a panic in a job is raised again in
+// the calling goroutine once all the jobs are done
+func parallel(p *workerPool, jobs ...func()) {
+	var wg sync.WaitGroup
+	var once sync.Once
+	var panicked interface{}
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job func()) {
+			defer wg.Done()
+			defer func() {
+				if err := recover(); err != nil {
+					once.Do(func() { panicked = err })
+				}
+			}()
+			p.run(job)
+		}(job)
+	}
+	wg.Wait()
+	if panicked != nil {
+		panic(panicked)
+	}
+}
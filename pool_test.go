@@ -0,0 +1,96 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// a nil pool runs jobs directly, in the calling goroutine
+func TestWorkerPoolNil(t *testing.T) {
+	var p *workerPool
+	done := false
+	p.run(func() { done = true })
+	if !done {
+		t.Error("job not run")
+	}
+}
+
+// a pool never runs more jobs at a time than its size, and parallel waits
+// for all the jobs
+func TestWorkerPoolSize(t *testing.T) {
+	tests := []struct {
+		size, maxRunning int
+	}{
+		{0, 1}, {1, 1}, {3, 3},
+	}
+	for _, test := range tests {
+		var mutex sync.Mutex
+		running, maxRunning, done := 0, 0, 0
+		jobs := make([]func(), 8)
+		for i := range jobs {
+			jobs[i] = func() {
+				mutex.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mutex.Unlock()
+				time.Sleep(5 * time.Millisecond)
+				mutex.Lock()
+				running--
+				done++
+				mutex.Unlock()
+			}
+		}
+		parallel(newWorkerPool(test.size), jobs...)
+		if done != len(jobs) {
+			t.Errorf("pool of size %d: %d jobs done out of %d", test.size, done, len(jobs))
+		}
+		if maxRunning > test.maxRunning {
+			t.Errorf("pool of size %d: %d jobs at a time, expected at most %d", test.size, maxRunning, test.maxRunning)
+		}
+	}
+}
+
+// a panic in a job is raised again by parallel once all the jobs are done
+func TestParallelPanic(t *testing.T) {
+	for _, p := range []*workerPool{nil, newWorkerPool(2)} {
+		var done int32
+		slow := func() {
+			time.Sleep(10 * time.Millisecond)
+			atomic.AddInt32(&done, 1)
+		}
+		failing := func() { panic("job failed") }
+		func() {
+			defer func() {
+				if err := recover(); err != "job failed" {
+					t.Errorf("panic %v, expected job failed", err)
+				}
+				if done != 3 {
+					t.Errorf("%d jobs done before the panic, expected 3", done)
+				}
+			}()
+			parallel(p, slow, failing, slow, slow)
+		}()
+	}
+}
@@ -19,6 +19,7 @@ along with this program.  If not, see https://www.gnu.org/licenses/.
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 	"os"
@@ -35,6 +36,30 @@ func (m modelInfo) writexmlFormulas(formulas []formula, fileName string, formula
 		filePath = filepath.Join(m.directory, fileName)
 	}
 
+	writexmlProperties(m.asProperties(formulas, formulaType), filePath, logger)
+}
+
+// give ids and descriptions to a set of formulas generated for a given model
+func (m modelInfo) asProperties(formulas []formula, formulaType string) []property {
+	properties := make([]property, len(formulas))
+	for i := 0; i < len(formulas); i++ {
+		properties[i] = property{
+			id:          m.formulaID(formulaType, i),
+			description: fmt.Sprint("Automatically generated by Citili ", version),
+			formula:     formulas[i],
+		}
+	}
+	return properties
+}
+
+// id of the i-th formula of a given type generated for a model
+func (m modelInfo) formulaID(formulaType string, i int) string {
+	return fmt.Sprintf("%s-%s-%s-%2.2d", m.name(), formulaType, year, i)
+}
+
+// print a set of properties as xml in a file
+func writexmlProperties(properties []property, filePath string, logger *log.Logger) {
+
 	f, error := os.Create(filePath)
 	if error != nil {
 		logger.Print("ERROR: cannot create file ", filePath)
@@ -51,8 +76,8 @@ func (m modelInfo) writexmlFormulas(formulas []formula, fileName string, formula
 		return
 	}
 
-	for i := 0; i < len(formulas); i++ {
-		_, error = f.WriteString(formulas[i].xmlPrint(m, i, formulaType))
+	for i := 0; i < len(properties); i++ {
+		_, error = f.WriteString(properties[i].xmlPrint())
 		if error != nil {
 			logger.Print("ERROR: cannot write to file ", filePath)
 			return
@@ -78,24 +103,119 @@ func (m modelInfo) writexmlFormulas(formulas []formula, fileName string, formula
 	}
 }
 
-// output one formula as xml
-func (f formula) xmlPrint(m modelInfo, num int, formulaType string) (xmlp string) {
-	kind := "COL"
-	if m.modelType != col {
-		kind = "PT"
+// print the verdicts obtained when filtering a set of formulas generated
+// for a given model, in the MCC output format (one line per formula:
+// FORMULA <id> <verdict> TECHNIQUES <techniques>), the number of states
+// explored is only given in the metadata of the formulas
+func (m modelInfo) writeVerdicts(results []filterResult, fileName string, formulaType string, logger *log.Logger) {
+
+	filePath := filepath.Join(m.directory, fileName)
+	f, error := os.Create(filePath)
+	if error != nil {
+		logger.Print("ERROR: cannot create file ", filePath)
+		return
 	}
 
-	fid := fmt.Sprintf(
-		"%s-%s-%s-%s-%s-%2.2d",
-		m.modelName, kind, m.modelInstance, formulaType, year, num,
-	)
+	for i, r := range results {
+		_, error = f.WriteString(r.verdictLine(m.formulaID(formulaType, i)))
+		if error != nil {
+			logger.Print("ERROR: cannot write to file ", filePath)
+			return
+		}
+	}
+
+	error = f.Sync()
+	if error != nil {
+		logger.Print("ERROR: cannot sync file ", filePath)
+		return
+	}
+
+	error = f.Close()
+	if error != nil {
+		logger.Print("ERROR: cannot close file ", filePath)
+		return
+	}
+}
+
+// metadata of a generated formula
+type formulaMetadata struct {
+	ID         string  `json:"id"`
+	Status     string  `json:"status"`
+	Verdict    string  `json:"verdict"`
+	Technique  string  `json:"technique"`
+	States     int     `json:"states"`
+	Budget     int     `json:"budget"`
+	Size       int     `json:"size"`
+	Depth      int     `json:"depth"`
+	Difficulty float64 `json:"difficulty"`
+}
 
-	xmlf := f.asxml(indent + indent + indent)
+// print the filtering and the difficulty of a set of formulas generated for a
+// given model as json in a file of the model directory
+func (m modelInfo) writeMetadata(results []filterResult, fileName string, formulaType string, logger *log.Logger) {
+
+	filePath := filepath.Join(m.directory, fileName)
+	metadata := make([]formulaMetadata, len(results))
+	for i, r := range results {
+		metadata[i] = formulaMetadata{
+			ID:         m.formulaID(formulaType, i),
+			Status:     r.status.String(),
+			Verdict:    r.value(),
+			Technique:  r.technique,
+			States:     r.difficulty.states,
+			Budget:     r.difficulty.budget,
+			Size:       r.difficulty.size,
+			Depth:      r.difficulty.depth,
+			Difficulty: r.difficulty.score,
+		}
+	}
+
+	content, error := json.MarshalIndent(metadata, "", "  ")
+	if error != nil {
+		logger.Print("ERROR: cannot encode metadata for file ", filePath)
+		return
+	}
+	error = os.WriteFile(filePath, append(content, '\n'), 0644)
+	if error != nil {
+		logger.Print("ERROR: cannot write to file ", filePath)
+	}
+}
+
+// verdict of a formula as given in the output of the MCC: TRUE, FALSE, the
+// value of a bound, or UNKNOWN if the formula was not decided
+func (r filterResult) value() string {
+	if r.status == trivial || r.status == decided {
+		switch r.verdict {
+		case trueVerdict:
+			return "TRUE"
+		case falseVerdict:
+			return "FALSE"
+		case boundVerdict:
+			return fmt.Sprint(r.bound)
+		}
+	}
+	return "UNKNOWN"
+}
+
+// output the verdict of one formula
+func (r filterResult) verdictLine(id string) string {
+	value := r.value()
+	technique := r.technique
+	if technique == "" {
+		technique = "NONE"
+	}
+	return fmt.Sprint("FORMULA ", id, " ", value, " TECHNIQUES ", technique, "\n")
+}
+
+// output one property as xml
+func (p property) xmlPrint() (xmlp string) {
+
+	xmlf := p.formula.asxml(indent + indent + indent)
 
 	xmlp = fmt.Sprint(
 		indent, "<property>\n",
-		indent, indent, "<id>", fid, "</id>\n",
-		indent, indent, "<description>Automatically generated by Citili ", version, "</description>\n",
+		indent, indent, "<id>", p.id, "</id>\n",
+		indent, indent, "<description>", p.description, "</description>\n",
 		indent, indent, "<formula>\n",
 		xmlf,
 		indent, indent, "</formula>\n",
@@ -208,6 +328,16 @@ func (f formula) asxml(currentIndent string) (xmlf string) {
 			xmlp,
 			currentIndent, "</tokens-count>\n",
 		)
+	case "place-bound":
+		xmlp := f.operand[0].asxmlplace(currentIndent + indent)
+		for i := 1; i < len(f.operand); i++ {
+			xmlp = xmlp + f.operand[i].asxmlplace(currentIndent+indent)
+		}
+		xmlf = fmt.Sprint(
+			currentIndent, "<place-bound>\n",
+			xmlp,
+			currentIndent, "</place-bound>\n",
+		)
 	case "integer-constant":
 		xmlf = fmt.Sprint(
 			currentIndent, "<integer-constant>",
@@ -241,14 +371,20 @@ func (m modelInfo) writehrFormulas(formulas []formula, fileName string, formulaT
 		filePath = filepath.Join(m.directory, fileName)
 	}
 
+	writehrProperties(m.asProperties(formulas, formulaType), filePath, logger)
+}
+
+// print a set of properties as a human-readable format in a file
+func writehrProperties(properties []property, filePath string, logger *log.Logger) {
+
 	f, error := os.Create(filePath)
 	if error != nil {
 		logger.Print("ERROR: cannot create file ", filePath)
 		return
 	}
 
-	for i := 0; i < len(formulas); i++ {
-		_, error = f.WriteString(formulas[i].hrPrint(m, i, formulaType))
+	for i := 0; i < len(properties); i++ {
+		_, error = f.WriteString(properties[i].hrPrint())
 		if error != nil {
 			logger.Print("ERROR: cannot write to file ", filePath)
 			return
@@ -268,23 +404,14 @@ func (m modelInfo) writehrFormulas(formulas []formula, fileName string, formulaT
 	}
 }
 
-// output one formula in a human-readable format
-func (f formula) hrPrint(m modelInfo, num int, formulaType string) (hrp string) {
-	kind := "COL"
-	if m.modelType != col {
-		kind = "PT"
-	}
-
-	fid := fmt.Sprintf(
-		"Property %s-%s-%s-%s-%s-%2.2d",
-		m.modelName, kind, m.modelInstance, formulaType, year, num,
-	)
+// output one property in a human-readable format
+func (p property) hrPrint() (hrp string) {
 
-	hrf := f.ashr()
+	hrf := p.formula.ashr()
 
 	hrp = fmt.Sprint(
-		fid, "\n",
-		indent, "\"Automatically generated by Citili ", version, "\"\n",
+		"Property ", p.id, "\n",
+		indent, "\"", p.description, "\"\n",
 		indent, "is:\n",
 		indent, indent, hrf, "\n",
 		indent, "end.\n",
@@ -333,6 +460,12 @@ func (f formula) ashr() (hrf string) {
 			hrff = hrff + ", " + f.operand[i].ashrplace()
 		}
 		hrf = "tokens-count(" + hrff + ")"
+	case "place-bound":
+		hrff := f.operand[0].ashrplace()
+		for i := 1; i < len(f.operand); i++ {
+			hrff = hrff + ", " + f.operand[i].ashrplace()
+		}
+		hrf = "place-bound(" + hrff + ")"
 	case "integer-constant":
 		hrf = f.operand[0].operator.name
 	}
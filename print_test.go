@@ -0,0 +1,91 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// filtering of formulas of each kind, with their difficulty
+func printTestResults() []filterResult {
+	results := []filterResult{
+		{status: trivial, verdict: trueVerdict, states: -1, technique: "INITIAL_MARKING"},
+		{status: decided, verdict: falseVerdict, states: 12, technique: "EXPLICIT"},
+		{status: decided, verdict: boundVerdict, bound: 3, states: 40, technique: "SEQUENTIAL_PROCESSING DECISION_DIAGRAMS"},
+		{status: hard, verdict: unknownVerdict, states: 100, technique: "EXPLICIT"},
+		{status: skipped, verdict: unknownVerdict, states: -1},
+	}
+	for i := range results {
+		results[i].difficulty = newDifficulty(fireable("t0"), results[i], 100)
+	}
+	return results
+}
+
+// the verdicts file can be read as MCC outputs: nothing follows the techniques
+func TestWriteVerdicts(t *testing.T) {
+	m := modelInfo{modelName: "Toy", modelType: pt, modelInstance: "001", directory: t.TempDir()}
+	m.writeVerdicts(printTestResults(), "CTLFireability.verdicts", "CTLFireability", log.New(io.Discard, "", 0))
+	content, err := os.ReadFile(filepath.Join(m.directory, "CTLFireability.verdicts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "FORMULA Toy-PT-001-CTLFireability-" + year + "-00 TRUE TECHNIQUES INITIAL_MARKING\n" +
+		"FORMULA Toy-PT-001-CTLFireability-" + year + "-01 FALSE TECHNIQUES EXPLICIT\n" +
+		"FORMULA Toy-PT-001-CTLFireability-" + year + "-02 3 TECHNIQUES SEQUENTIAL_PROCESSING DECISION_DIAGRAMS\n" +
+		"FORMULA Toy-PT-001-CTLFireability-" + year + "-03 UNKNOWN TECHNIQUES EXPLICIT\n" +
+		"FORMULA Toy-PT-001-CTLFireability-" + year + "-04 UNKNOWN TECHNIQUES NONE\n"
+	if string(content) != expected {
+		t.Errorf("verdicts:\n%s\nexpected:\n%s", content, expected)
+	}
+}
+
+// the number of states explored is given in the metadata
+func TestWriteMetadata(t *testing.T) {
+	m := modelInfo{modelName: "Toy", modelType: pt, modelInstance: "001", directory: t.TempDir()}
+	m.writeMetadata(printTestResults(), "CTLFireability.json", "CTLFireability", log.New(io.Discard, "", 0))
+	content, err := os.ReadFile(filepath.Join(m.directory, "CTLFireability.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var metadata []formulaMetadata
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	statuses := make([]string, len(metadata))
+	states := make([]int, len(metadata))
+	for i, md := range metadata {
+		statuses[i] = md.Status
+		states[i] = md.States
+	}
+	if !reflect.DeepEqual(statuses, []string{"trivial", "decided", "decided", "hard", "skipped"}) {
+		t.Errorf("statuses %v", statuses)
+	}
+	if !reflect.DeepEqual(states, []int{1, 12, 40, 100, -1}) {
+		t.Errorf("states %v", states)
+	}
+	if metadata[2].Verdict != "3" || metadata[4].Difficulty != -1 {
+		t.Errorf("metadata %+v", metadata)
+	}
+}
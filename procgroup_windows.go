@@ -0,0 +1,36 @@
+//go:build windows
+// +build windows
+
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "os/exec"
+
+// no process groups, only the checker itself is killed
+func setProcessGroup(command *exec.Cmd) {}
+
+func killProcessGroup(command *exec.Cmd) error {
+	return command.Process.Kill()
+}
+
+// memory cannot be limited
+func limitMemory(args []string, memory int) []string {
+	return args
+}
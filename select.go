@@ -0,0 +1,145 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"flag"
+	"log"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// model selection given on the command line, overriding the configuration
+type modelSelectionFlags struct {
+	include string
+	exclude string
+	types   string
+}
+
+func addModelSelectionFlags(flags *flag.FlagSet) *modelSelectionFlags {
+	var s modelSelectionFlags
+	flags.StringVar(&s.include, "include", "", "comma-separated patterns of the models to consider (overrides IncludeModels)")
+	flags.StringVar(&s.exclude, "exclude", "", "comma-separated patterns of the models to ignore (overrides ExcludeModels)")
+	flags.StringVar(&s.types, "types", "", "comma-separated types of the models to consider, COL and/or PT (overrides ModelTypes)")
+	return &s
+}
+
+// to be called once the configuration file has been read
+func (s *modelSelectionFlags) apply() {
+	if s.include != "" {
+		globalConfiguration.IncludeModels = strings.Split(s.include, ",")
+	}
+	if s.exclude != "" {
+		globalConfiguration.ExcludeModels = strings.Split(s.exclude, ",")
+	}
+	if s.types != "" {
+		globalConfiguration.ModelTypes = strings.Split(s.types, ",")
+	}
+}
+
+// a pattern is either a glob (as in path.Match) or a regular expression
+// prefixed by re:, it matches a model if it matches its full name
+// (Name-TYPE-Instance) or only its name
+type modelPattern struct {
+	glob   string
+	regexp *regexp.Regexp
+}
+
+func compileModelPatterns(patterns []string) []modelPattern {
+	compiled := make([]modelPattern, len(patterns))
+	for i, p := range patterns {
+		if strings.HasPrefix(p, "re:") {
+			re, err := regexp.Compile("^(?:" + strings.TrimPrefix(p, "re:") + ")$")
+			if err != nil {
+				log.Fatal("Error in model selection pattern ", p, ": ", err)
+			}
+			compiled[i].regexp = re
+			continue
+		}
+		if _, err := path.Match(p, ""); err != nil {
+			log.Fatal("Error in model selection pattern ", p, ": ", err)
+		}
+		compiled[i].glob = p
+	}
+	return compiled
+}
+
+func (p modelPattern) matchString(s string) bool {
+	if p.regexp != nil {
+		return p.regexp.MatchString(s)
+	}
+	ok, _ := path.Match(p.glob, s)
+	return ok
+}
+
+func (p modelPattern) matches(m *modelInfo) bool {
+	return p.matchString(m.name()) || p.matchString(m.modelName)
+}
+
+func anyMatches(patterns []modelPattern, m *modelInfo) bool {
+	for _, p := range patterns {
+		if p.matches(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// checks if a model (not considering its twin) is selected by the configuration
+func isSelected(m *modelInfo, include, exclude []modelPattern) bool {
+	if len(globalConfiguration.ModelTypes) > 0 {
+		kind := "PT"
+		if m.modelType == col {
+			kind = "COL"
+		}
+		typeOk := false
+		for _, t := range globalConfiguration.ModelTypes {
+			typeOk = typeOk || strings.EqualFold(t, kind)
+		}
+		if !typeOk {
+			return false
+		}
+	}
+	if len(include) > 0 && !anyMatches(include, m) {
+		return false
+	}
+	return !anyMatches(exclude, m)
+}
+
+// keep only the models selected by the configuration, a COL model and its
+// PT twin are always kept together as formulas of the PT model are partly
+// obtained by unfolding formulas of the COL one
+func selectModels(models []*modelInfo) []*modelInfo {
+	include := compileModelPatterns(globalConfiguration.IncludeModels)
+	exclude := compileModelPatterns(globalConfiguration.ExcludeModels)
+
+	selected := make([]*modelInfo, 0, len(models))
+	for _, m := range models {
+		if isSelected(m, include, exclude) ||
+			(m.twinModel != nil && isSelected(m.twinModel, include, exclude)) {
+			selected = append(selected, m)
+		}
+	}
+
+	if len(selected) < len(models) {
+		log.Print("Model selection: ", len(selected), " models (or COL/PT twins) selected out of ", len(models))
+	}
+	return selected
+}
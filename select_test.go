@@ -0,0 +1,103 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// models of the selection tests: Philosophers and Dekker have COL/PT twins,
+// Kanban only has a PT instance
+func selectionTestModels() []*modelInfo {
+	philoCOL := &modelInfo{modelName: "Philosophers", modelType: col, modelInstance: "000005"}
+	philoPT := &modelInfo{modelName: "Philosophers", modelType: pt, modelInstance: "000005", twinModel: philoCOL}
+	philoCOL.twinModel = philoPT
+	dekkerCOL := &modelInfo{modelName: "Dekker", modelType: col, modelInstance: "010"}
+	dekkerPT := &modelInfo{modelName: "Dekker", modelType: pt, modelInstance: "010", twinModel: dekkerCOL}
+	dekkerCOL.twinModel = dekkerPT
+	kanban := &modelInfo{modelName: "Kanban", modelType: pt, modelInstance: "00020"}
+	return []*modelInfo{philoCOL, philoPT, dekkerCOL, dekkerPT, kanban}
+}
+
+func TestSelectModels(t *testing.T) {
+	tests := []struct {
+		name     string
+		include  []string
+		exclude  []string
+		types    []string
+		expected []string
+	}{
+		{"all", nil, nil, nil, []string{
+			"Philosophers-COL-000005", "Philosophers-PT-000005", "Dekker-COL-010", "Dekker-PT-010", "Kanban-PT-00020"}},
+		{"glob on full name", []string{"Kanban-*-00020"}, nil, nil, []string{"Kanban-PT-00020"}},
+		{"glob on name", []string{"Kan*"}, nil, nil, []string{"Kanban-PT-00020"}},
+		{"regexp", []string{"re:Philo.*"}, nil, nil, []string{"Philosophers-COL-000005", "Philosophers-PT-000005"}},
+		{"regexp matches the whole name", []string{"re:Philo"}, nil, nil, []string{}},
+		{"several patterns", []string{"Kanban", "re:D.*"}, nil, nil, []string{"Dekker-COL-010", "Dekker-PT-010", "Kanban-PT-00020"}},
+		{"exclude", nil, []string{"Dekker"}, nil, []string{"Philosophers-COL-000005", "Philosophers-PT-000005", "Kanban-PT-00020"}},
+		{"include and exclude", []string{"re:.*"}, []string{"Kanban-PT-*"}, nil, []string{
+			"Philosophers-COL-000005", "Philosophers-PT-000005", "Dekker-COL-010", "Dekker-PT-010"}},
+		{"PT twin of an included COL model", []string{"Dekker-COL-010"}, nil, nil, []string{"Dekker-COL-010", "Dekker-PT-010"}},
+		{"COL twin of an included PT model", []string{"Philosophers-PT-*"}, nil, nil, []string{"Philosophers-COL-000005", "Philosophers-PT-000005"}},
+		{"excluded twin kept with its model", nil, []string{"*-PT-*"}, nil, []string{
+			"Philosophers-COL-000005", "Philosophers-PT-000005", "Dekker-COL-010", "Dekker-PT-010"}},
+		{"both twins excluded", nil, []string{"Philosophers-*"}, nil, []string{"Dekker-COL-010", "Dekker-PT-010", "Kanban-PT-00020"}},
+		{"COL type with twins", nil, nil, []string{"COL"}, []string{
+			"Philosophers-COL-000005", "Philosophers-PT-000005", "Dekker-COL-010", "Dekker-PT-010"}},
+		{"type is case insensitive", nil, nil, []string{"pt"}, []string{
+			"Philosophers-COL-000005", "Philosophers-PT-000005", "Dekker-COL-010", "Dekker-PT-010", "Kanban-PT-00020"}},
+		{"type and pattern", []string{"Kanban"}, nil, []string{"COL"}, []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setTestConfig(t, func(c *config) {
+				c.IncludeModels = test.include
+				c.ExcludeModels = test.exclude
+				c.ModelTypes = test.types
+			})
+			selected := selectModels(selectionTestModels())
+			names := make([]string, len(selected))
+			for i, m := range selected {
+				names[i] = m.name()
+			}
+			if strings.Join(names, " ") != strings.Join(test.expected, " ") {
+				t.Errorf("selected %v, expected %v", names, test.expected)
+			}
+		})
+	}
+}
+
+func TestModelSelectionFlags(t *testing.T) {
+	setTestConfig(t, func(c *config) {
+		c.IncludeModels = []string{"Dekker"}
+		c.ExcludeModels = []string{"Kanban"}
+	})
+	s := modelSelectionFlags{include: "Philosophers,re:K.*", types: "PT"}
+	s.apply()
+	if strings.Join(globalConfiguration.IncludeModels, " ") != "Philosophers re:K.*" {
+		t.Errorf("include patterns %v", globalConfiguration.IncludeModels)
+	}
+	if strings.Join(globalConfiguration.ExcludeModels, " ") != "Kanban" {
+		t.Errorf("exclude patterns %v, not overridden by an empty flag", globalConfiguration.ExcludeModels)
+	}
+	if strings.Join(globalConfiguration.ModelTypes, " ") != "PT" {
+		t.Errorf("types %v", globalConfiguration.ModelTypes)
+	}
+}
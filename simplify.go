@@ -0,0 +1,229 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "strconv"
+
+// Simplification of a formula (with atoms substituted), bottom-up:
+//   - negations are pushed to atoms (through and, or, A G, A F, E G, E F,
+//     and G, F in LTL), but not through X and U that have no dual here
+//   - nested and/or are flattened and duplicate operands removed
+//   - constant comparisons are folded (c1 <= c2, 0 <= x, tokens-count(P) <=
+//     tokens-count(Q) with P included in Q) and constants propagated
+//   - repeated modalities are merged (A G A G, E F E F, A F A F, E G E G,
+//     and G G, F F in LTL)
+//
+// The result may contain the true and false constants, which cannot be
+// written in the MCC format: such formulas are trivial and should be
+// discarded (see containsConstant).
+func simplify(f formula) formula {
+	switch f.operator.name {
+	case "is-fireable", "tokens-count", "place-bound", "integer-constant", "atom", "true", "false":
+		return f
+	case "leq":
+		return foldComparison(f)
+	}
+
+	operands := make([]formula, len(f.operand))
+	for i, operand := range f.operand {
+		operands[i] = simplify(operand)
+	}
+	if f.operator.name == "not" {
+		return negation(operands[0])
+	}
+	return simplifyNode(f.operator, operands)
+}
+
+// simplification of a node whose operands are already simplified
+func simplifyNode(op operator, operands []formula) formula {
+	switch op.name {
+	case "and", "or":
+		return simplifyJunction(op, operands)
+	case "A", "E":
+		operand := operands[0]
+		if isConstant(operand) {
+			return operand
+		}
+		// A G A G phi = A G phi, E F E F phi = E F phi, ...
+		if operand.operator.name == "G" || operand.operator.name == "F" {
+			inner := operand.operand[0]
+			if inner.operator.name == op.name && inner.operand[0].operator.name == operand.operator.name {
+				return inner
+			}
+		}
+	case "G", "F":
+		operand := operands[0]
+		if isConstant(operand) {
+			return operand
+		}
+		// G G phi = G phi, F F phi = F phi
+		if operand.operator.name == op.name {
+			return operand
+		}
+	case "U":
+		before, reach := operands[0], operands[1]
+		switch {
+		case isConstant(reach):
+			return reach
+		case before.operator.name == "true":
+			return formula{operator: finallyOperator, operand: []formula{reach}}
+		case before.operator.name == "false":
+			return reach
+		}
+	}
+	return formula{operator: op, operand: operands}
+}
+
+// flatten nested conjunctions (disjunctions), remove duplicate and neutral
+// operands, and propagate absorbing constants
+func simplifyJunction(op operator, operands []formula) formula {
+	absorbing, neutral := "false", "true"
+	if op.name == "or" {
+		absorbing, neutral = "true", "false"
+	}
+
+	flat := make([]formula, 0, len(operands))
+	var add func(f formula)
+	add = func(f formula) {
+		if f.operator.name == op.name {
+			for _, operand := range f.operand {
+				add(operand)
+			}
+			return
+		}
+		if f.operator.name == neutral {
+			return
+		}
+		for _, g := range flat {
+			if g.equals(f) {
+				return
+			}
+		}
+		flat = append(flat, f)
+	}
+	for _, operand := range operands {
+		if operand.operator.name == absorbing {
+			return operand
+		}
+		add(operand)
+	}
+
+	switch len(flat) {
+	case 0:
+		return formula{operator: operator{name: neutral}}
+	case 1:
+		return flat[0]
+	}
+	op.maxArity = len(flat)
+	return formula{operator: op, operand: flat}
+}
+
+// the simplified negation of a simplified formula
+func negation(f formula) formula {
+	switch f.operator.name {
+	case "true":
+		return formula{operator: falseConstant}
+	case "false":
+		return formula{operator: trueConstant}
+	case "not":
+		return f.operand[0]
+	case "and", "or":
+		dual := orOperator
+		if f.operator.name == "or" {
+			dual = andOperator
+		}
+		operands := make([]formula, len(f.operand))
+		for i, operand := range f.operand {
+			operands[i] = negation(operand)
+		}
+		return simplifyJunction(dual, operands)
+	case "A", "E":
+		// not A G phi = E F not phi, not E F phi = A G not phi, ...
+		path := f.operand[0]
+		if path.operator.name == "G" || path.operator.name == "F" {
+			quantifier := existsPathOperator
+			if f.operator.name == "E" {
+				quantifier = allPathsOperator
+			}
+			return simplifyNode(quantifier, []formula{negation(path)})
+		}
+	case "G":
+		return simplifyNode(finallyOperator, []formula{negation(f.operand[0])})
+	case "F":
+		return simplifyNode(globallyOperator, []formula{negation(f.operand[0])})
+	}
+	return formula{operator: notOperator, operand: []formula{f}}
+}
+
+// fold comparisons that do not depend on the marking
+func foldComparison(f formula) formula {
+	left, right := f.operand[0], f.operand[1]
+	if left.operator.name == "integer-constant" {
+		small, _ := strconv.Atoi(left.operand[0].operator.name)
+		if small <= 0 {
+			return formula{operator: trueConstant}
+		}
+		if right.operator.name == "integer-constant" {
+			big, _ := strconv.Atoi(right.operand[0].operator.name)
+			if small <= big {
+				return formula{operator: trueConstant}
+			}
+			return formula{operator: falseConstant}
+		}
+	}
+	if left.operator.name == "tokens-count" && right.operator.name == "tokens-count" && includedNodes(left.operand, right.operand) {
+		return formula{operator: trueConstant}
+	}
+	return f
+}
+
+// checks if all the places (transitions) of an atom appear in another atom
+func includedNodes(nodes, in []formula) bool {
+	found := make(map[string]bool)
+	for _, n := range in {
+		found[n.operator.name] = true
+	}
+	for _, n := range nodes {
+		if !found[n.operator.name] {
+			return false
+		}
+	}
+	return true
+}
+
+func isConstant(f formula) bool {
+	return f.operator.name == "true" || f.operator.name == "false"
+}
+
+// Checks if a formula contains true or false, it is then either trivial
+// or not expressible in the MCC format
+func containsConstant(f formula) bool {
+	switch f.operator.name {
+	case "true", "false":
+		return true
+	case "is-fireable", "tokens-count", "place-bound", "integer-constant":
+		return false
+	}
+	for _, operand := range f.operand {
+		if containsConstant(operand) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import "testing"
+
+func TestSimplify(t *testing.T) {
+	// true and false stand for the constants, that cannot be parsed
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`is-fireable("t0")`, `is-fireable("t0")`},
+		{`! ! is-fireable("t0")`, `is-fireable("t0")`},
+		{`! A G is-fireable("t0")`, `E (F (! (is-fireable("t0"))))`},
+		{`! E F is-fireable("t0")`, `A (G (! (is-fireable("t0"))))`},
+		{`! A F is-fireable("t0")`, `E (G (! (is-fireable("t0"))))`},
+		{`A ! G is-fireable("t0")`, `A (F (! (is-fireable("t0"))))`},
+		{`! (is-fireable("t0") & is-fireable("t1"))`, `(! (is-fireable("t0"))) | (! (is-fireable("t1")))`},
+		{`! X is-fireable("t0")`, `! (X (is-fireable("t0")))`},
+		{`is-fireable("t0") & (is-fireable("t1") & is-fireable("t0"))`, `(is-fireable("t0")) & (is-fireable("t1"))`},
+		{`is-fireable("t0") | is-fireable("t0")`, `is-fireable("t0")`},
+		{`A G A G is-fireable("t0")`, `A (G (is-fireable("t0")))`},
+		{`E F E F is-fireable("t0")`, `E (F (is-fireable("t0")))`},
+		{`A G E G is-fireable("t0")`, `A (G (E (G (is-fireable("t0")))))`},
+		{`A G G is-fireable("t0")`, `A (G (is-fireable("t0")))`},
+		{`A F F is-fireable("t0")`, `A (F (is-fireable("t0")))`},
+		{`2 <= 3`, `true`},
+		{`3 <= 2`, `false`},
+		{`0 <= tokens-count("p0")`, `true`},
+		{`tokens-count("p0") <= tokens-count("p1", "p0")`, `true`},
+		{`tokens-count("p0", "p1") <= tokens-count("p0")`, `tokens-count("p0", "p1") <= tokens-count("p0")`},
+		{`is-fireable("t0") & 3 <= 2`, `false`},
+		{`is-fireable("t0") | 3 <= 2`, `is-fireable("t0")`},
+		{`is-fireable("t0") | ! 3 <= 2`, `true`},
+		{`A G 1 <= 1`, `true`},
+		{`E (3 <= 2 U is-fireable("t0"))`, `E (is-fireable("t0"))`},
+		{`E (is-fireable("t1") U 3 <= 2)`, `false`},
+	}
+	for _, test := range tests {
+		f := simplify(mustParse(t, test.input))
+		got := f.ashr()
+		if isConstant(f) {
+			got = f.operator.name
+		}
+		if got != test.expected {
+			t.Errorf("%s simplified as %s, expected %s", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestContainsConstant(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`A G is-fireable("t0")`, false},
+		{`A G (is-fireable("t0") & 3 <= 2)`, true},
+		{`E F (is-fireable("t0") | 1 <= tokens-count("p0"))`, false},
+		{`E (is-fireable("t0") U 0 <= tokens-count("p0"))`, true},
+	}
+	for _, test := range tests {
+		if got := containsConstant(simplify(mustParse(t, test.input))); got != test.expected {
+			t.Errorf("%s: constant %t, expected %t", test.input, got, test.expected)
+		}
+	}
+}
+
+func TestGenSimplifiedGivesUp(t *testing.T) {
+	tries := 0
+	trivial := func() (formula, error) {
+		tries++
+		return mustParse(t, `A G 1 <= 2`), nil
+	}
+	if _, err := genSimplified(trivial, isReachabilityFormula); err == nil {
+		t.Error("a formula was found")
+	}
+	if tries != maxGenerationTries {
+		t.Errorf("%d tries, expected %d", tries, maxGenerationTries)
+	}
+}
@@ -0,0 +1,380 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// largest number of entries of the matrix used for computing P-invariants,
+// and largest absolute value of these entries
+const (
+	maxInvariantEntries int = 1 << 24
+	maxInvariantValue   int = 1 << 30
+)
+
+// result of the structural analysis of a PT net
+type structure struct {
+	invariants int    // number of semi-positive P-invariants found, -1 if not computed
+	bound      []int  // upper bound of each place given by the P-invariants, -1 if unknown
+	dead       []bool // transitions that can never fire
+	constant   []bool // places whose number of tokens never changes
+}
+
+// Structural analysis of a PT net, finding transitions that can never fire
+// and places whose marking never changes, using:
+//   - P-invariants: a transition with an input place bounded below the
+//     weight of its arc cannot fire
+//   - siphons: the largest siphon unmarked in the initial marking stays
+//     unmarked, the transitions with an input place in it cannot fire
+//   - places that no transition that may fire changes are constant
+//
+// Until nothing changes, as dead transitions make more places constant.
+func (net *petriNet) analyse() structure {
+	s := structure{
+		bound:    make([]int, len(net.places)),
+		dead:     make([]bool, len(net.transitions)),
+		constant: make([]bool, len(net.places)),
+	}
+	for p := range s.bound {
+		s.bound[p] = -1
+	}
+	invariants, computed := net.pInvariants()
+	s.invariants = -1
+	if computed {
+		s.invariants = len(invariants)
+		for _, y := range invariants {
+			weighted := 0
+			for p, w := range y {
+				weighted += w * net.initialMarking[p]
+			}
+			for p, w := range y {
+				if w > 0 && (s.bound[p] < 0 || weighted/w < s.bound[p]) {
+					s.bound[p] = weighted / w
+				}
+			}
+		}
+	}
+
+	for changed := true; changed; {
+		changed = net.deadByBounds(s) || net.deadBySiphon(s) || net.constantPlaces(s)
+	}
+	return s
+}
+
+// transitions with an input place that can never hold enough tokens
+func (net *petriNet) deadByBounds(s structure) (changed bool) {
+	for t := range net.transitions {
+		if s.dead[t] {
+			continue
+		}
+		for _, a := range net.pre[t] {
+			bound := s.bound[a.place]
+			if s.constant[a.place] {
+				bound = net.initialMarking[a.place]
+			}
+			if bound >= 0 && bound < a.weight {
+				s.dead[t] = true
+				changed = true
+				break
+			}
+		}
+	}
+	return changed
+}
+
+// transitions with an input place in the largest siphon unmarked in the
+// initial marking
+func (net *petriNet) deadBySiphon(s structure) (changed bool) {
+	siphon := make([]bool, len(net.places))
+	for p, tokens := range net.initialMarking {
+		siphon[p] = tokens == 0
+	}
+	// a place is not in the siphon if a transition may put tokens
+	// in it without taking tokens from the siphon
+	for removed := true; removed; {
+		removed = false
+		for t := range net.transitions {
+			if s.dead[t] || net.hasInputIn(t, siphon) {
+				continue
+			}
+			for _, a := range net.post[t] {
+				if siphon[a.place] {
+					siphon[a.place] = false
+					removed = true
+				}
+			}
+		}
+	}
+	for t := range net.transitions {
+		if !s.dead[t] && net.hasInputIn(t, siphon) {
+			s.dead[t] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (net *petriNet) hasInputIn(t int, places []bool) bool {
+	for _, a := range net.pre[t] {
+		if places[a.place] {
+			return true
+		}
+	}
+	return false
+}
+
+// places not changed by the transitions that may fire
+func (net *petriNet) constantPlaces(s structure) (changed bool) {
+	effect := make([]int, len(net.places))
+	changing := make([]bool, len(net.places))
+	for t := range net.transitions {
+		if s.dead[t] {
+			continue
+		}
+		for _, a := range net.pre[t] {
+			effect[a.place] -= a.weight
+		}
+		for _, a := range net.post[t] {
+			effect[a.place] += a.weight
+		}
+		for _, a := range net.pre[t] {
+			changing[a.place] = changing[a.place] || effect[a.place] != 0
+			effect[a.place] = 0
+		}
+		for _, a := range net.post[t] {
+			changing[a.place] = changing[a.place] || effect[a.place] != 0
+			effect[a.place] = 0
+		}
+	}
+	for p := range net.places {
+		if !s.constant[p] && !changing[p] {
+			s.constant[p] = true
+			changed = true
+		}
+	}
+	return changed
+}
+
+// semi-positive P-invariants of the net (Farkas algorithm), not computed
+// if they are too many or too large
+func (net *petriNet) pInvariants() (invariants [][]int, computed bool) {
+	numPlaces, numTransitions := len(net.places), len(net.transitions)
+	width := numTransitions + numPlaces
+	if numPlaces*width > maxInvariantEntries {
+		return nil, false
+	}
+
+	// rows of the incidence matrix, extended with the identity
+	rows := make([][]int, numPlaces)
+	for p := range rows {
+		rows[p] = make([]int, width)
+		rows[p][numTransitions+p] = 1
+	}
+	for t := range net.transitions {
+		for _, a := range net.pre[t] {
+			rows[a.place][t] -= a.weight
+		}
+		for _, a := range net.post[t] {
+			rows[a.place][t] += a.weight
+		}
+	}
+
+	// cancel the columns of the incidence matrix one by one
+	for t := 0; t < numTransitions; t++ {
+		next := make([][]int, 0)
+		positive, negative := make([][]int, 0), make([][]int, 0)
+		for _, r := range rows {
+			switch {
+			case r[t] > 0:
+				positive = append(positive, r)
+			case r[t] < 0:
+				negative = append(negative, r)
+			default:
+				next = append(next, r)
+			}
+		}
+		if (len(next)+len(positive)*len(negative))*width > maxInvariantEntries {
+			return nil, false
+		}
+		seen := make(map[string]bool)
+		for _, r := range next {
+			seen[fmt.Sprint(r)] = true
+		}
+		for _, pos := range positive {
+			for _, neg := range negative {
+				r := make([]int, width)
+				divisor := 0
+				for i := range r {
+					r[i] = -neg[t]*pos[i] + pos[t]*neg[i]
+					if r[i] > maxInvariantValue || r[i] < -maxInvariantValue {
+						return nil, false
+					}
+					divisor = gcd(divisor, r[i])
+				}
+				if divisor > 1 {
+					for i := range r {
+						r[i] /= divisor
+					}
+				}
+				if key := fmt.Sprint(r); !seen[key] {
+					seen[key] = true
+					next = append(next, r)
+				}
+			}
+		}
+		rows = next
+	}
+
+	invariants = make([][]int, len(rows))
+	for i, r := range rows {
+		invariants[i] = r[numTransitions:]
+	}
+	return invariants, true
+}
+
+func gcd(a, b int) int {
+	if a < 0 {
+		a = -a
+	}
+	if b < 0 {
+		b = -b
+	}
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// remove from the nodes used for generation the ones that would give
+// trivial atoms: transitions that can never fire and places that are
+// constant, and list them in a report in the model directory
+func (m *modelInfo) excludeTrivialNodes(logger *log.Logger) {
+	if !globalConfiguration.StructuralAnalysis {
+		return
+	}
+	net, err := m.ptNet()
+	if err != nil {
+		logger.Print("Warning: no structural analysis: ", err)
+		return
+	}
+	s := net.analyse()
+	isDead := trivialNodes("transition", net.transitionIndex, s.dead, logger)
+	isConstant := trivialNodes("place", net.placeIndex, s.constant, logger)
+
+	if m.modelType == col {
+		unfolding := m.unfoldingModel()
+		m.excludeNodes(s, net, mappedTrivial(unfolding.placesMapping, isConstant), mappedTrivial(unfolding.transitionsMapping, isDead), logger)
+		if m.twinModel != nil {
+			m.twinModel.net = net
+			m.twinModel.excludeNodes(s, net, isConstant, isDead, logger)
+		}
+		return
+	}
+	m.excludeNodes(s, net, isConstant, isDead, logger)
+}
+
+// whether nodes of the net are trivial, according to the structural analysis,
+// nodes that are not in the net are reported (once) and kept as non trivial
+func trivialNodes(kind string, index map[string]int, trivial []bool, logger *log.Logger) func(string) bool {
+	missing := make(map[string]bool)
+	return func(n string) bool {
+		i, ok := index[n]
+		if !ok {
+			if !missing[n] {
+				missing[n] = true
+				logger.Print("Warning: ", kind, " ", n, " is not in the analysed net, kept for generation")
+			}
+			return false
+		}
+		return trivial[i]
+	}
+}
+
+// a COL node is trivial if all the PT nodes it is unfolded to are
+func mappedTrivial(mapping map[string][]string, isTrivial func(string) bool) func(string) bool {
+	return func(n string) bool {
+		if len(mapping[n]) == 0 {
+			return false
+		}
+		for _, pt := range mapping[n] {
+			if !isTrivial(pt) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (m *modelInfo) excludeNodes(s structure, net *petriNet, isConstant, isDead func(string) bool, logger *log.Logger) {
+	if m.excludedPlaces != nil || m.excludedTransitions != nil {
+		return
+	}
+	m.places, m.excludedPlaces = splitNodes(m.places, isConstant)
+	m.transitions, m.excludedTransitions = splitNodes(m.transitions, isDead)
+	excludedPlaces, excludedTransitions := m.excludedPlaces, m.excludedTransitions
+	logger.Print(
+		"Structural analysis: ", len(excludedPlaces), " constant places and ",
+		len(excludedTransitions), " dead transitions excluded",
+	)
+	if !writeModelFiles {
+		return
+	}
+
+	lines := []string{
+		fmt.Sprint("# structural analysis of ", m.name()),
+		fmt.Sprint("net: ", len(net.places), " places, ", len(net.transitions), " transitions"),
+	}
+	if s.invariants < 0 {
+		lines = append(lines, "P-invariants: not computed (too many or too large)")
+	} else {
+		lines = append(lines, fmt.Sprint("P-invariants: ", s.invariants))
+	}
+	lines = append(lines, fmt.Sprint("excluded places (constant): ", len(excludedPlaces)))
+	lines = append(lines, excludedPlaces...)
+	lines = append(lines, fmt.Sprint("excluded transitions (dead): ", len(excludedTransitions)))
+	lines = append(lines, excludedTransitions...)
+
+	filePath := filepath.Join(m.directory, globalConfiguration.StructureFile)
+	if err := os.WriteFile(filePath, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		logger.Print("ERROR: cannot write structural analysis report: ", err)
+	}
+}
+
+// split nodes into the non trivial ones and the trivial ones, all the nodes
+// are kept if they are all trivial
+func splitNodes(nodes []string, isTrivial func(string) bool) (kept, excluded []string) {
+	kept = make([]string, 0, len(nodes))
+	excluded = make([]string, 0)
+	for _, n := range nodes {
+		if isTrivial(n) {
+			excluded = append(excluded, n)
+		} else {
+			kept = append(kept, n)
+		}
+	}
+	if len(kept) == 0 {
+		return nodes, make([]string, 0)
+	}
+	return kept, excluded
+}
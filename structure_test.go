@@ -0,0 +1,115 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAnalyse(t *testing.T) {
+	tests := []struct {
+		name       string
+		net        *petriNet
+		invariants int
+		bound      []int
+		dead       []bool
+		constant   []bool
+	}{
+		{
+			"cycle", cycleNet(),
+			1, []int{1, 1}, []bool{false, false}, []bool{false, false},
+		},
+		{
+			"unbounded", unboundedNet(),
+			0, []int{-1}, []bool{false}, []bool{false},
+		},
+		{
+			// t2 needs two tokens in p0, but p0 + p1 = 1
+			"dead by bounds",
+			newTestNet(
+				[]string{"p0", "p1"}, []int{1, 0},
+				testTransition{"t0", map[string]int{"p0": 1}, map[string]int{"p1": 1}},
+				testTransition{"t1", map[string]int{"p1": 1}, map[string]int{"p0": 1}},
+				testTransition{"t2", map[string]int{"p0": 2}, map[string]int{"p1": 2}},
+			),
+			1, []int{1, 1}, []bool{false, false, true}, []bool{false, false},
+		},
+		{
+			// nothing puts tokens in p0, so t0 never fires and then only the
+			// self-loop t1 may fire, which leaves all the places unchanged
+			"dead by siphon",
+			newTestNet(
+				[]string{"p0", "p1"}, []int{0, 1},
+				testTransition{"t0", map[string]int{"p0": 1}, map[string]int{"p1": 1}},
+				testTransition{"t1", map[string]int{"p1": 1}, map[string]int{"p1": 1}},
+			),
+			1, []int{1, 1}, []bool{true, false}, []bool{true, true},
+		},
+		{
+			// p1 is an unmarked siphon, so t1 and t2 never fire and only p2
+			// is changed, by t0
+			"dead by constant places",
+			newTestNet(
+				[]string{"p0", "p1", "p2"}, []int{1, 0, 0},
+				testTransition{"t0", nil, map[string]int{"p2": 1}},
+				testTransition{"t1", map[string]int{"p1": 1}, map[string]int{"p1": 1, "p0": 1}},
+				testTransition{"t2", map[string]int{"p0": 1, "p1": 1}, nil},
+			),
+			0, []int{-1, -1, -1}, []bool{false, true, true}, []bool{true, true, false},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := test.net.analyse()
+			if s.invariants != test.invariants {
+				t.Errorf("%d invariants, expected %d", s.invariants, test.invariants)
+			}
+			if !reflect.DeepEqual(s.bound, test.bound) {
+				t.Errorf("bounds %v, expected %v", s.bound, test.bound)
+			}
+			if !reflect.DeepEqual(s.dead, test.dead) {
+				t.Errorf("dead transitions %v, expected %v", s.dead, test.dead)
+			}
+			if !reflect.DeepEqual(s.constant, test.constant) {
+				t.Errorf("constant places %v, expected %v", s.constant, test.constant)
+			}
+		})
+	}
+}
+
+func TestTrivialNodes(t *testing.T) {
+	var output bytes.Buffer
+	logger := log.New(&output, "", 0)
+	isDead := trivialNodes("transition", map[string]int{"t0": 0, "t1": 1}, []bool{true, false}, logger)
+	for _, test := range []struct {
+		node    string
+		trivial bool
+	}{{"t0", true}, {"t1", false}, {"t2", false}, {"t2", false}} {
+		if trivial := isDead(test.node); trivial != test.trivial {
+			t.Errorf("%s trivial: %v, expected %v", test.node, trivial, test.trivial)
+		}
+	}
+	if strings.Count(output.String(), "transition t2 ") != 1 || strings.Contains(output.String(), "t0") {
+		t.Errorf("reported:\n%s\nexpected t2 only, once", output.String())
+	}
+}
@@ -0,0 +1,545 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/loig/pinimili/pnml"
+)
+
+// largest number of places or bindings of a transition that is unfolded
+const maxUnfoldedNodes int = 1 << 20
+
+// a color, as the sequence of the colors of its non-product components
+// (dots are left out)
+type color []colorComponent
+
+type colorComponent struct {
+	sort  *colorSort
+	index int // index of the color in the constants of its sort
+}
+
+// identification of a color in multisets, by the ids of its constants so
+// that colors of different sorts are not mixed up
+func (c color) key() string {
+	constants := make([]string, len(c))
+	for i, cc := range c {
+		constants[i] = cc.sort.constants[cc.index]
+	}
+	return strings.Join(constants, ",")
+}
+
+// the way a color is written in the ids of unfolded nodes
+func (c color) label() string {
+	constants := make([]string, len(c))
+	for i, cc := range c {
+		constants[i] = cc.sort.constants[cc.index]
+	}
+	return strings.Join(constants, "_")
+}
+
+// all the colors of a sequence of non-product sorts
+func allColors(sorts []*colorSort) ([]color, error) {
+	size := 1
+	for _, s := range sorts {
+		size *= len(s.constants)
+		if size > maxUnfoldedNodes {
+			return nil, errors.New("too many colors")
+		}
+	}
+	colors := []color{{}}
+	for _, s := range sorts {
+		next := make([]color, 0, len(colors)*len(s.constants))
+		for _, c := range colors {
+			for i := range s.constants {
+				cc := make(color, len(c), len(c)+1)
+				copy(cc, c)
+				next = append(next, append(cc, colorComponent{sort: s, index: i}))
+			}
+		}
+		colors = next
+	}
+	return colors, nil
+}
+
+// values of the variables of a transition
+type binding map[string]color
+
+// a colored net being unfolded
+type unfolder struct {
+	d           *colorDeclarations
+	net         *petriNet
+	placeColors map[string]map[string]int // index of the unfolded place for each color of each place
+	rangeSorts  map[[2]int]*colorSort     // sorts of finite int range constants, by bounds
+}
+
+// an arc of a colored net, from the point of view of its transition
+type coloredArc struct {
+	place       string
+	inscription *pnml.HLTerm
+}
+
+// unfold a colored net (symmetric net subset used in the MCC) into a PT net,
+// the mappings give the unfolded places and transitions of each colored node,
+// the ids of unfolded nodes are the ids of colored nodes followed by colors
+// (of the place or of the variables of the transition), separated by _
+func unfoldColoredNet(p *pnml.Pnml) (net *petriNet, placesMapping, transitionsMapping map[string][]string, err error) {
+	for _, n := range p.Nets {
+		if n.Type != nil && *n.Type == ptNetType {
+			return nil, nil, nil, errors.New("not a colored net")
+		}
+	}
+
+	u := unfolder{
+		d: newColorDeclarations(p),
+		net: &petriNet{
+			placeIndex:      make(map[string]int),
+			transitionIndex: make(map[string]int),
+		},
+		placeColors: make(map[string]map[string]int),
+		rangeSorts:  make(map[[2]int]*colorSort),
+	}
+	placesMapping = make(map[string][]string)
+	transitionsMapping = make(map[string][]string)
+	pages := allPages(p)
+	resolve := referenceResolver(pages)
+
+	// places
+	for _, pa := range pages {
+		for _, pl := range pa.Places {
+			ids, err := u.unfoldPlace(pl)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("place %s: %w", *pl.ID, err)
+			}
+			placesMapping[*pl.ID] = ids
+		}
+	}
+
+	// arcs, grouped by transition
+	inputs := make(map[string][]coloredArc)
+	outputs := make(map[string][]coloredArc)
+	for _, pa := range pages {
+		for _, a := range pa.Arcs {
+			if a.HLInscription == nil || a.HLInscription.Structure == nil {
+				return nil, nil, nil, fmt.Errorf("arc %s without inscription", *a.ID)
+			}
+			source := resolve(*a.Source)
+			target := resolve(*a.Target)
+			if _, isPlace := u.placeColors[source]; isPlace {
+				inputs[target] = append(inputs[target], coloredArc{source, a.HLInscription.Structure.Term})
+				continue
+			}
+			if _, isPlace := u.placeColors[target]; isPlace {
+				outputs[source] = append(outputs[source], coloredArc{target, a.HLInscription.Structure.Term})
+				continue
+			}
+			return nil, nil, nil, fmt.Errorf("arc %s is not connected to a place", *a.ID)
+		}
+	}
+
+	// transitions
+	variables := u.d.transitionVariables(pages, resolve)
+	for _, pa := range pages {
+		for _, tr := range pa.Transitions {
+			var guard *pnml.HLTerm
+			if tr.Condition != nil && tr.Condition.Structure != nil {
+				guard = tr.Condition.Structure.Term
+			}
+			ids, err := u.unfoldTransition(*tr.ID, variables[*tr.ID], guard, inputs[*tr.ID], outputs[*tr.ID])
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("transition %s: %w", *tr.ID, err)
+			}
+			transitionsMapping[*tr.ID] = ids
+		}
+	}
+
+	return u.net, placesMapping, transitionsMapping, nil
+}
+
+func (u *unfolder) unfoldPlace(pl pnml.Place) ([]string, error) {
+	var sorts []*colorSort
+	if pl.Type != nil && pl.Type.Structure != nil && pl.Type.Structure.Sort != nil {
+		s, err := u.d.sort(pl.Type.Structure.Sort)
+		if err != nil {
+			return nil, err
+		}
+		sorts = s.flatten()
+	}
+	colors, err := allColors(sorts)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(colors))
+	u.placeColors[*pl.ID] = make(map[string]int)
+	for _, c := range colors {
+		id := unfoldedID(*pl.ID, c)
+		if _, exists := u.net.placeIndex[id]; exists {
+			return nil, fmt.Errorf("duplicate unfolded place %s", id)
+		}
+		u.placeColors[*pl.ID][c.key()] = len(u.net.places)
+		u.net.placeIndex[id] = len(u.net.places)
+		u.net.places = append(u.net.places, id)
+		u.net.initialMarking = append(u.net.initialMarking, 0)
+		ids = append(ids, id)
+	}
+
+	if pl.HLInitialMarking != nil && pl.HLInitialMarking.Structure != nil {
+		tokens, err := u.multiset(pl.HLInitialMarking.Structure.Term, nil)
+		if err != nil {
+			return nil, err
+		}
+		for key, n := range tokens {
+			p, exists := u.placeColors[*pl.ID][key]
+			if !exists || n < 0 {
+				return nil, errors.New("initial marking does not match the sort")
+			}
+			u.net.initialMarking[p] += n
+		}
+	}
+
+	return ids, nil
+}
+
+func (u *unfolder) unfoldTransition(id string, variables []string, guard *pnml.HLTerm, inputs, outputs []coloredArc) ([]string, error) {
+	// all the bindings of the variables
+	sorts := make([]*colorSort, 0)
+	widths := make([]int, len(variables))
+	for i, v := range variables {
+		h, declared := u.d.variables[v]
+		if !declared {
+			return nil, fmt.Errorf("unknown variable %s", v)
+		}
+		s, err := u.d.sort(h)
+		if err != nil {
+			return nil, err
+		}
+		flat := s.flatten()
+		widths[i] = len(flat)
+		sorts = append(sorts, flat...)
+	}
+	colors, err := allColors(sorts)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0)
+	for _, c := range colors {
+		b := make(binding)
+		for i, v := range variables {
+			b[v] = c[:widths[i]]
+			c = c[widths[i]:]
+		}
+		if guard != nil {
+			enabled, err := u.boolean(guard, b)
+			if err != nil {
+				return nil, err
+			}
+			if !enabled {
+				continue
+			}
+		}
+
+		pre, err := u.arcs(inputs, b)
+		if err != nil {
+			return nil, err
+		}
+		post, err := u.arcs(outputs, b)
+		if err != nil {
+			return nil, err
+		}
+
+		tid := id
+		for _, v := range variables {
+			tid = unfoldedID(tid, b[v])
+		}
+		if _, exists := u.net.transitionIndex[tid]; exists {
+			return nil, fmt.Errorf("duplicate unfolded transition %s", tid)
+		}
+		u.net.transitionIndex[tid] = len(u.net.transitions)
+		u.net.transitions = append(u.net.transitions, tid)
+		u.net.pre = append(u.net.pre, pre)
+		u.net.post = append(u.net.post, post)
+		ids = append(ids, tid)
+	}
+
+	return ids, nil
+}
+
+// the id of the unfolding of a node for a color
+func unfoldedID(id string, c color) string {
+	if len(c) == 0 {
+		return id
+	}
+	return id + "_" + c.label()
+}
+
+// the unfolded arcs corresponding to colored arcs, for a binding
+func (u *unfolder) arcs(arcs []coloredArc, b binding) ([]arcWeight, error) {
+	weights := make([]arcWeight, 0)
+	for _, a := range arcs {
+		tokens, err := u.multiset(a.inscription, b)
+		if err != nil {
+			return nil, err
+		}
+		for key, n := range tokens {
+			p, exists := u.placeColors[a.place][key]
+			if !exists || n < 0 {
+				return nil, fmt.Errorf("inscription does not match the sort of place %s", a.place)
+			}
+			if n > 0 {
+				weights = addArc(weights, p, n)
+			}
+		}
+	}
+	return weights, nil
+}
+
+// evaluation of a term as a multiset of colors
+func (u *unfolder) multiset(t *pnml.HLTerm, b binding) (map[string]int, error) {
+	ms := make(map[string]int)
+	err := u.addMultiset(ms, t, b, 1)
+	return ms, err
+}
+
+func (u *unfolder) addMultiset(ms map[string]int, t *pnml.HLTerm, b binding, factor int) error {
+	switch v := t.Value.(type) {
+	case pnml.MultisetNumberOf:
+		if len(v.Terms) != 2 {
+			return errors.New("numberof should have two subterms")
+		}
+		n, err := u.integer(v.Terms[0].Term)
+		if err != nil {
+			return err
+		}
+		return u.addMultiset(ms, v.Terms[1].Term, b, factor*n)
+	case pnml.MultisetScalarProduct:
+		if len(v.Terms) != 2 {
+			return errors.New("scalarproduct should have two subterms")
+		}
+		n, err := u.integer(v.Terms[0].Term)
+		if err != nil {
+			return err
+		}
+		return u.addMultiset(ms, v.Terms[1].Term, b, factor*n)
+	case pnml.MultisetAdd:
+		for _, st := range v.Terms {
+			if err := u.addMultiset(ms, st.Term, b, factor); err != nil {
+				return err
+			}
+		}
+		return nil
+	case pnml.MultisetSubtract:
+		for i, st := range v.Terms {
+			f := factor
+			if i > 0 {
+				f = -factor
+			}
+			if err := u.addMultiset(ms, st.Term, b, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	case pnml.MultisetAll:
+		s, err := u.d.sort(v.Sort)
+		if err != nil {
+			return err
+		}
+		colors, err := allColors(s.flatten())
+		if err != nil {
+			return err
+		}
+		for _, c := range colors {
+			ms[c.key()] += factor
+		}
+		return nil
+	case pnml.MultisetEmpty:
+		return nil
+	}
+
+	c, err := u.color(t, b)
+	if err != nil {
+		return err
+	}
+	ms[c.key()] += factor
+	return nil
+}
+
+// evaluation of a term as a number
+func (u *unfolder) integer(t *pnml.HLTerm) (int, error) {
+	if v, isConstant := t.Value.(pnml.IntNumberConstant); isConstant && v.Value != nil {
+		return *v.Value, nil
+	}
+	return 0, fmt.Errorf("unsupported number term %s", t.Type)
+}
+
+// evaluation of a term as a color
+func (u *unfolder) color(t *pnml.HLTerm, b binding) (color, error) {
+	switch v := t.Value.(type) {
+	case pnml.HLVariable:
+		c, bound := b[*v.ID]
+		if !bound {
+			return nil, fmt.Errorf("unbound variable %s", *v.ID)
+		}
+		return c, nil
+	case pnml.DotConstant:
+		return color{}, nil
+	case pnml.HLUserOperator:
+		c, isConstant := u.d.constants[*v.ID]
+		if !isConstant {
+			return nil, fmt.Errorf("unsupported operator %s", *v.ID)
+		}
+		return color{c}, nil
+	case pnml.FIRConstant:
+		if v.Value == nil || v.FIRSort == nil || v.FIRSort.Start == nil || v.FIRSort.End == nil {
+			return nil, errors.New("finite int range constant without value or sort")
+		}
+		bounds := [2]int{*v.FIRSort.Start, *v.FIRSort.End}
+		s, known := u.rangeSorts[bounds]
+		if !known {
+			var err error
+			s, err = u.d.sort(&pnml.HLSort{Type: "finiteintrange", Value: *v.FIRSort})
+			if err != nil {
+				return nil, err
+			}
+			u.rangeSorts[bounds] = s
+		}
+		index := *v.Value - *v.FIRSort.Start
+		if index < 0 || index >= len(s.constants) {
+			return nil, fmt.Errorf("constant %d out of range", *v.Value)
+		}
+		return color{{sort: s, index: index}}, nil
+	case pnml.CyclicEnumSuccessor:
+		return u.shift(v.Terms, b, 1)
+	case pnml.CyclicEnumPredecessor:
+		return u.shift(v.Terms, b, -1)
+	case pnml.HLTupleOperator:
+		c := make(color, 0)
+		for _, st := range v.Terms {
+			cc, err := u.color(st.Term, b)
+			if err != nil {
+				return nil, err
+			}
+			c = append(c, cc...)
+		}
+		return c, nil
+	}
+	return nil, fmt.Errorf("unsupported color term %s", t.Type)
+}
+
+// successor or predecessor of a color of a cyclic enumeration
+func (u *unfolder) shift(terms []pnml.HLSubterm, b binding, by int) (color, error) {
+	if len(terms) != 1 {
+		return nil, errors.New("successor/predecessor should have one subterm")
+	}
+	c, err := u.color(terms[0].Term, b)
+	if err != nil {
+		return nil, err
+	}
+	if len(c) != 1 {
+		return nil, errors.New("successor/predecessor of a non simple color")
+	}
+	n := len(c[0].sort.constants)
+	return color{{sort: c[0].sort, index: ((c[0].index+by)%n + n) % n}}, nil
+}
+
+// evaluation of a term as a boolean
+func (u *unfolder) boolean(t *pnml.HLTerm, b binding) (bool, error) {
+	switch v := t.Value.(type) {
+	case pnml.BoolConstant:
+		return v.Value != nil && *v.Value, nil
+	case pnml.BoolAnd:
+		for _, st := range v.Terms {
+			value, err := u.boolean(st.Term, b)
+			if err != nil || !value {
+				return false, err
+			}
+		}
+		return true, nil
+	case pnml.BoolOr:
+		for _, st := range v.Terms {
+			value, err := u.boolean(st.Term, b)
+			if err != nil || value {
+				return value, err
+			}
+		}
+		return false, nil
+	case pnml.BoolNot:
+		if len(v.Terms) != 1 {
+			return false, errors.New("not should have one subterm")
+		}
+		value, err := u.boolean(v.Terms[0].Term, b)
+		return !value, err
+	case pnml.BoolImply:
+		if len(v.Terms) != 2 {
+			return false, errors.New("imply should have two subterms")
+		}
+		premise, err := u.boolean(v.Terms[0].Term, b)
+		if err != nil || !premise {
+			return true, err
+		}
+		return u.boolean(v.Terms[1].Term, b)
+	case pnml.BoolEquality:
+		cmp, err := u.compare(v.Terms, b)
+		return cmp == 0, err
+	case pnml.BoolInequality:
+		cmp, err := u.compare(v.Terms, b)
+		return cmp != 0, err
+	case pnml.FIRLessThan:
+		cmp, err := u.compare(v.Terms, b)
+		return cmp < 0, err
+	case pnml.FIRLessThanOrEqual:
+		cmp, err := u.compare(v.Terms, b)
+		return cmp <= 0, err
+	case pnml.FIRGreaterThan:
+		cmp, err := u.compare(v.Terms, b)
+		return cmp > 0, err
+	case pnml.FIRGreaterThanOrEqual:
+		cmp, err := u.compare(v.Terms, b)
+		return cmp >= 0, err
+	}
+	return false, fmt.Errorf("unsupported boolean term %s", t.Type)
+}
+
+// comparison of two colors, following the order of the constants of their sorts
+func (u *unfolder) compare(terms []pnml.HLSubterm, b binding) (int, error) {
+	if len(terms) != 2 {
+		return 0, errors.New("comparison should have two subterms")
+	}
+	left, err := u.color(terms[0].Term, b)
+	if err != nil {
+		return 0, err
+	}
+	right, err := u.color(terms[1].Term, b)
+	if err != nil {
+		return 0, err
+	}
+	if len(left) != len(right) {
+		return 0, errors.New("comparison of colors of different sorts")
+	}
+	for i := range left {
+		if left[i].index != right[i].index {
+			return left[i].index - right[i].index, nil
+		}
+	}
+	return 0, nil
+}
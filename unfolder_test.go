@@ -0,0 +1,314 @@
+/*
+Citili, a program for generating CTL formulas for the model checking contest
+Copyright (C) 2020  Loïg Jezequel
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see https://www.gnu.org/licenses/.
+*/
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/loig/pinimili/pnml"
+)
+
+// declarations shared by the colored nets of the unfolder tests: a cyclic
+// enumeration C, a finite enumeration D, their product P, and variables x,
+// y of sort C and z of sort D (declared in this order)
+const unfolderTestDeclarations = `
+<namedsort id="C" name="C"><cyclicenumeration>
+ <feconstant id="a" name="a"/><feconstant id="b" name="b"/><feconstant id="c" name="c"/>
+</cyclicenumeration></namedsort>
+<namedsort id="D" name="D"><finiteenumeration>
+ <feconstant id="d1" name="left"/><feconstant id="d2" name="right"/>
+</finiteenumeration></namedsort>
+<namedsort id="P" name="P"><productsort><usersort declaration="C"/><usersort declaration="D"/></productsort></namedsort>
+<variabledecl id="x" name="x"><usersort declaration="C"/></variabledecl>
+<variabledecl id="y" name="y"><usersort declaration="C"/></variabledecl>
+<variabledecl id="z" name="z"><usersort declaration="D"/></variabledecl>`
+
+// a symmetric net with the test declarations and the given page content,
+// parsed from a temporary file as models are
+func testColoredNet(t *testing.T, page string) *pnml.Pnml {
+	t.Helper()
+	content := `<?xml version="1.0"?>
+<pnml xmlns="http://www.pnml.org/version-2009/grammar/pnml">
+<net id="test" type="http://www.pnml.org/version-2009/grammar/symmetricnet">
+<declaration><structure><declarations>` + unfolderTestDeclarations + `</declarations></structure></declaration>
+<page id="page">` + page + `</page>
+</net>
+</pnml>`
+	path := filepath.Join(t.TempDir(), "model.pnml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return pnml.GetPnml(path, false)
+}
+
+// pnml fragments of the tests
+
+func place(id, sort, marking string) string {
+	if marking != "" {
+		marking = `<hlinitialMarking><structure>` + marking + `</structure></hlinitialMarking>`
+	}
+	return `<place id="` + id + `"><type><structure>` + sort + `</structure></type>` + marking + `</place>`
+}
+
+func transition(id, guard string) string {
+	if guard != "" {
+		guard = `<condition><structure>` + guard + `</structure></condition>`
+	}
+	return `<transition id="` + id + `">` + guard + `</transition>`
+}
+
+func arc(source, target, inscription string) string {
+	return `<arc id="` + source + "-" + target + `" source="` + source + `" target="` + target + `"><hlinscription><structure>` +
+		inscription + `</structure></hlinscription></arc>`
+}
+
+func userSort(id string) string { return `<usersort declaration="` + id + `"/>` }
+
+func term(name string, subterms ...string) string {
+	return "<" + name + "><subterm>" + strings.Join(subterms, "</subterm><subterm>") + "</subterm></" + name + ">"
+}
+
+func numberOf(n int, color string) string {
+	return term("numberof", fmt.Sprintf(`<numberconstant value="%d"><positive/></numberconstant>`, n), color)
+}
+
+func variable(id string) string      { return `<variable refvariable="` + id + `"/>` }
+func colorConstant(id string) string { return `<useroperator declaration="` + id + `"/>` }
+func allOf(sort string) string       { return `<all>` + userSort(sort) + `</all>` }
+func dotSort() string                { return `<dot/>` }
+func dotConstant() string            { return `<dotconstant/>` }
+func tuple(colors ...string) string  { return term("tuple", colors...) }
+
+// readable description of an unfolded net: the initial marking of each
+// place, and the input and output places (with weights) of each transition
+func describeNet(net *petriNet) (places, transitions []string) {
+	for i, p := range net.places {
+		places = append(places, fmt.Sprint(p, "=", net.initialMarking[i]))
+	}
+	arcs := func(weights []arcWeight) string {
+		s := make([]string, len(weights))
+		for i, w := range weights {
+			s[i] = fmt.Sprint(net.places[w.place], "*", w.weight)
+		}
+		sort.Strings(s)
+		return strings.Join(s, " ")
+	}
+	for i, t := range net.transitions {
+		transitions = append(transitions, fmt.Sprint(t, ": ", arcs(net.pre[i]), " -> ", arcs(net.post[i])))
+	}
+	return places, transitions
+}
+
+func TestUnfoldColoredNet(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        []string
+		places      []string
+		transitions []string
+	}{
+		{
+			"successor and predecessor",
+			[]string{
+				place("p", userSort("C"), allOf("C")),
+				transition("s", ""),
+				transition("r", ""),
+				arc("p", "s", numberOf(1, variable("x"))),
+				arc("s", "p", numberOf(1, term("successor", variable("x")))),
+				arc("p", "r", numberOf(1, term("predecessor", variable("x")))),
+				arc("r", "p", numberOf(2, variable("x"))),
+			},
+			[]string{"p_a=1", "p_b=1", "p_c=1"},
+			[]string{
+				"s_a: p_a*1 -> p_b*1", "s_b: p_b*1 -> p_c*1", "s_c: p_c*1 -> p_a*1",
+				"r_a: p_c*1 -> p_a*2", "r_b: p_a*1 -> p_b*2", "r_c: p_b*1 -> p_c*2",
+			},
+		},
+		{
+			"guards",
+			[]string{
+				place("p", userSort("C"), ""),
+				transition("t", term("lessthan", variable("x"), variable("y"))),
+				transition("u", term("and",
+					term("inequality", variable("x"), colorConstant("a")),
+					term("not", term("equality", variable("x"), variable("y"))))),
+				arc("p", "t", term("add", numberOf(1, variable("x")), numberOf(1, variable("y")))),
+				arc("p", "u", term("add", numberOf(1, variable("x")), numberOf(1, variable("y")))),
+			},
+			[]string{"p_a=0", "p_b=0", "p_c=0"},
+			[]string{
+				"t_a_b: p_a*1 p_b*1 -> ", "t_a_c: p_a*1 p_c*1 -> ", "t_b_c: p_b*1 p_c*1 -> ",
+				"u_b_a: p_a*1 p_b*1 -> ", "u_b_c: p_b*1 p_c*1 -> ", "u_c_a: p_a*1 p_c*1 -> ", "u_c_b: p_b*1 p_c*1 -> ",
+			},
+		},
+		{
+			"product sorts",
+			[]string{
+				place("q", userSort("P"), numberOf(2, tuple(colorConstant("b"), colorConstant("d2")))),
+				place("p", userSort("C"), ""),
+				transition("t", term("equality", variable("z"), colorConstant("d1"))),
+				arc("q", "t", numberOf(1, tuple(variable("x"), variable("z")))),
+				arc("t", "p", numberOf(1, variable("x"))),
+			},
+			[]string{"q_a_d1=0", "q_a_d2=0", "q_b_d1=0", "q_b_d2=2", "q_c_d1=0", "q_c_d2=0", "p_a=0", "p_b=0", "p_c=0"},
+			[]string{"t_a_d1: q_a_d1*1 -> p_a*1", "t_b_d1: q_b_d1*1 -> p_b*1", "t_c_d1: q_c_d1*1 -> p_c*1"},
+		},
+		{
+			"multiset operations",
+			[]string{
+				place("p", userSort("C"), term("subtract",
+					numberOf(2, allOf("C")),
+					numberOf(1, colorConstant("b")))),
+				place("d", dotSort(), numberOf(3, dotConstant())),
+				transition("t", ""),
+				arc("p", "t", term("subtract", allOf("C"), numberOf(1, variable("x")))),
+				arc("d", "t", numberOf(2, dotConstant())),
+				arc("t", "p", term("add", numberOf(1, variable("x")), numberOf(2, variable("x")))),
+			},
+			[]string{"p_a=2", "p_b=1", "p_c=2", "d=3"},
+			[]string{
+				"t_a: d*2 p_b*1 p_c*1 -> p_a*3",
+				"t_b: d*2 p_a*1 p_c*1 -> p_b*3",
+				"t_c: d*2 p_a*1 p_b*1 -> p_c*3",
+			},
+		},
+		{
+			"transition without variables",
+			[]string{
+				place("d", dotSort(), numberOf(1, dotConstant())),
+				place("p", userSort("D"), ""),
+				transition("t", ""),
+				arc("d", "t", numberOf(1, dotConstant())),
+				arc("t", "p", numberOf(1, colorConstant("d2"))),
+			},
+			[]string{"d=1", "p_d1=0", "p_d2=0"},
+			[]string{"t: d*1 -> p_d2*1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			net, placesMapping, transitionsMapping, err := unfoldColoredNet(testColoredNet(t, strings.Join(test.page, "\n")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			places, transitions := describeNet(net)
+			if !reflect.DeepEqual(places, test.places) {
+				t.Errorf("places:\n%s\nexpected:\n%s", strings.Join(places, "\n"), strings.Join(test.places, "\n"))
+			}
+			sort.Strings(transitions)
+			sort.Strings(test.transitions)
+			if !reflect.DeepEqual(transitions, test.transitions) {
+				t.Errorf("transitions:\n%s\nexpected:\n%s", strings.Join(transitions, "\n"), strings.Join(test.transitions, "\n"))
+			}
+			// the mappings give all the unfolded nodes, by colored node
+			checkUnfoldedNodes(t, placesMapping, net.places)
+			checkUnfoldedNodes(t, transitionsMapping, net.transitions)
+		})
+	}
+}
+
+func checkUnfoldedNodes(t *testing.T, mapping map[string][]string, unfolded []string) {
+	t.Helper()
+	mapped := make([]string, 0, len(unfolded))
+	for colored, ids := range mapping {
+		for _, id := range ids {
+			if id != colored && !strings.HasPrefix(id, colored+"_") {
+				t.Errorf("%s unfolded to %s", colored, id)
+			}
+		}
+		mapped = append(mapped, ids...)
+	}
+	sort.Strings(mapped)
+	all := append([]string{}, unfolded...)
+	sort.Strings(all)
+	if !reflect.DeepEqual(mapped, all) {
+		t.Errorf("mapped nodes %v, expected %v", mapped, all)
+	}
+}
+
+func TestUnfoldColoredNetErrors(t *testing.T) {
+	tests := map[string][]string{
+		"marking of another sort": {
+			place("p", userSort("C"), numberOf(1, colorConstant("d1"))),
+		},
+		"inscription of another sort": {
+			place("p", userSort("C"), ""),
+			transition("t", ""),
+			arc("p", "t", numberOf(1, variable("z"))),
+		},
+		"negative multiset": {
+			place("p", userSort("C"), term("subtract", numberOf(1, colorConstant("a")), numberOf(2, colorConstant("a")))),
+		},
+		"successor of a product": {
+			place("p", userSort("P"), ""),
+			transition("t", ""),
+			arc("p", "t", numberOf(1, term("successor", tuple(variable("x"), variable("z"))))),
+		},
+	}
+	for name, page := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, _, _, err := unfoldColoredNet(testColoredNet(t, strings.Join(page, "\n"))); err == nil {
+				t.Error("unfolded, expected an error")
+			}
+		})
+	}
+}
+
+// the variables of transitions are found in guards and arcs, and ordered as
+// declared, they give the color domains of transitions
+func TestColorDomains(t *testing.T) {
+	p := testColoredNet(t, strings.Join([]string{
+		place("p", userSort("C"), ""),
+		place("q", userSort("P"), ""),
+		place("d", dotSort(), ""),
+		transition("t", term("equality", variable("z"), colorConstant("d1"))),
+		transition("u", ""),
+		transition("v", ""),
+		arc("q", "t", numberOf(1, tuple(variable("y"), variable("z")))),
+		arc("t", "p", numberOf(1, variable("x"))),
+		arc("p", "u", numberOf(1, term("successor", variable("y")))),
+		arc("d", "v", numberOf(1, dotConstant())),
+	}, "\n"))
+
+	domainNames := func(domains map[string][]*colorSort) map[string]string {
+		names := make(map[string]string)
+		for node, sorts := range domains {
+			kinds := make([]string, len(sorts))
+			for i, s := range sorts {
+				kinds[i] = strings.Join(s.constants, ",")
+			}
+			names[node] = strings.Join(kinds, " ")
+		}
+		return names
+	}
+	places, transitions := colorDomains(p)
+	expectedPlaces := map[string]string{"p": "a,b,c", "q": "a,b,c d1,d2", "d": ""}
+	if names := domainNames(places); !reflect.DeepEqual(names, expectedPlaces) {
+		t.Errorf("domains of places %v, expected %v", names, expectedPlaces)
+	}
+	expectedTransitions := map[string]string{"t": "a,b,c a,b,c d1,d2", "u": "a,b,c", "v": ""}
+	if names := domainNames(transitions); !reflect.DeepEqual(names, expectedTransitions) {
+		t.Errorf("domains of transitions %v, expected %v", names, expectedTransitions)
+	}
+}